@@ -0,0 +1,253 @@
+package srtm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// Block compressed tile (hgt.blk) is a tile split into blocks of rows, each block
+// is compressed by zstd separately. Elevations are read with decompression of single
+// block, so tile takes compressed size on disk and small memory like raw tile.
+// Layout of file (little-endian):
+//
+//	magic "HGTB" | version uint8 | reserved [3]byte | size uint32 | rows per block uint32 | count of blocks uint32
+//	offsets of blocks from start of file [count of blocks + 1]uint64
+//	compressed blocks of big-endian elevations (as in hgt file)
+const (
+	blockMagic      = "HGTB"
+	blockVersion    = 1
+	blockHeaderSize = 20
+	// defaultBlockRows is a count of rows in block (115 KB of 1 arcsecond tile)
+	defaultBlockRows = 16
+	// blockCacheSize is a count of decompressed blocks cached by tile
+	blockCacheSize = 16
+)
+
+var (
+	blockDecoderOnce sync.Once
+	blockDecoder     *zstd.Decoder
+	blockDecoderErr  error
+)
+
+// decoder returns zstd decoder of blocks shared between tiles (DecodeAll is safe for concurrent use)
+func decoder() (*zstd.Decoder, error) {
+	blockDecoderOnce.Do(func() {
+		blockDecoder, blockDecoderErr = zstd.NewReader(nil)
+	})
+	return blockDecoder, blockDecoderErr
+}
+
+// blockTile is an index of block compressed tile file with cache of decompressed blocks
+type blockTile struct {
+	r       io.ReaderAt
+	size    int
+	rows    int
+	offsets []uint64
+	cache   *lru.Cache
+}
+
+// openBlockTile reads header and index of block compressed tile
+func openBlockTile(r io.ReaderAt, fileSize int64) (*blockTile, error) {
+	header := make([]byte, blockHeaderSize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, errors.Wrap(err, "read header of block tile")
+	}
+	if string(header[:4]) != blockMagic {
+		return nil, fmt.Errorf("block tile has invalid magic %q", header[:4])
+	}
+	if header[4] != blockVersion {
+		return nil, fmt.Errorf("block tile has unsupported version %d", header[4])
+	}
+	size := int(binary.LittleEndian.Uint32(header[8:]))
+	rows := int(binary.LittleEndian.Uint32(header[12:]))
+	count := int(binary.LittleEndian.Uint32(header[16:]))
+	if _, err := tileSize(int64(size) * int64(size) * 2); err != nil {
+		return nil, fmt.Errorf("block tile has unsupported size %d", size)
+	}
+	if rows < 1 || count != (size+rows-1)/rows {
+		return nil, fmt.Errorf("block tile has %d blocks of %d rows for size %d", count, rows, size)
+	}
+	index := make([]byte, (count+1)*8)
+	if _, err := r.ReadAt(index, blockHeaderSize); err != nil {
+		return nil, errors.Wrap(err, "read index of block tile")
+	}
+	offsets := make([]uint64, count+1)
+	for i := range offsets {
+		offsets[i] = binary.LittleEndian.Uint64(index[i*8:])
+	}
+	if offsets[0] != uint64(blockHeaderSize+len(index)) || offsets[count] != uint64(fileSize) {
+		return nil, fmt.Errorf("block tile index does not match file size %d", fileSize)
+	}
+	for i := 1; i < len(offsets); i++ {
+		if offsets[i] < offsets[i-1] {
+			return nil, fmt.Errorf("block tile index is not sorted at block %d", i)
+		}
+	}
+	cache, err := lru.New(blockCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	return &blockTile{
+		r:       r,
+		size:    size,
+		rows:    rows,
+		offsets: offsets,
+		cache:   cache,
+	}, nil
+}
+
+// rawSize returns size of raw tile
+func (b *blockTile) rawSize() int64 {
+	return int64(b.size) * int64(b.size) * 2
+}
+
+// block returns decompressed elevations of block
+func (b *blockTile) block(i int) ([]int16, error) {
+	if v, ok := b.cache.Get(i); ok {
+		return v.([]int16), nil
+	}
+	compressed := make([]byte, b.offsets[i+1]-b.offsets[i])
+	if _, err := b.r.ReadAt(compressed, int64(b.offsets[i])); err != nil {
+		return nil, errors.Wrapf(err, "read block %d", i)
+	}
+	d, err := decoder()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := d.DecodeAll(compressed, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "decompress block %d", i)
+	}
+	rows := b.rows
+	if last := b.size - i*b.rows; last < rows {
+		rows = last
+	}
+	if len(raw) != rows*b.size*2 {
+		return nil, fmt.Errorf("block %d has size %d instead of %d", i, len(raw), rows*b.size*2)
+	}
+	elevations := make([]int16, rows*b.size)
+	for j := range elevations {
+		elevations[j] = int16(binary.BigEndian.Uint16(raw[j*2:]))
+	}
+	b.cache.Add(i, elevations)
+	return elevations, nil
+}
+
+// elevation returns elevation by index of node in hgt order
+func (b *blockTile) elevation(idx int) (int16, error) {
+	i := idx / (b.rows * b.size)
+	elevations, err := b.block(i)
+	if err != nil {
+		return 0, err
+	}
+	return elevations[idx-i*b.rows*b.size], nil
+}
+
+// memSize returns approximate memory size of index and cached blocks
+func (b *blockTile) memSize() uint64 {
+	return uint64(len(b.offsets)*8 + b.cache.Len()*b.rows*b.size*2)
+}
+
+// raw returns decompressed content of all blocks in hgt format
+func (b *blockTile) raw() ([]byte, error) {
+	raw := make([]byte, 0, b.rawSize())
+	for i := 0; i < len(b.offsets)-1; i++ {
+		elevations, err := b.block(i)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range elevations {
+			raw = append(raw, byte(uint16(e)>>8), byte(e))
+		}
+	}
+	return raw, nil
+}
+
+// writeBlocks writes raw content of tile in block compressed format with zstd level
+// (1-22, zero is a default level)
+func writeBlocks(w io.Writer, raw []byte, level int) error {
+	size, err := tileSize(int64(len(raw)))
+	if err != nil {
+		return err
+	}
+	l := zstd.SpeedDefault
+	if level != 0 {
+		l = zstd.EncoderLevelFromZstd(level)
+	}
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(l), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return err
+	}
+	defer enc.Close()
+	count := (size + defaultBlockRows - 1) / defaultBlockRows
+	blocks := make([][]byte, count)
+	offsets := make([]uint64, count+1)
+	offsets[0] = uint64(blockHeaderSize + (count+1)*8)
+	rowBytes := size * 2
+	for i := range blocks {
+		end := (i + 1) * defaultBlockRows * rowBytes
+		if end > len(raw) {
+			end = len(raw)
+		}
+		blocks[i] = enc.EncodeAll(raw[i*defaultBlockRows*rowBytes:end], nil)
+		offsets[i+1] = offsets[i] + uint64(len(blocks[i]))
+	}
+	header := make([]byte, offsets[0])
+	copy(header, blockMagic)
+	header[4] = blockVersion
+	binary.LittleEndian.PutUint32(header[8:], uint32(size))
+	binary.LittleEndian.PutUint32(header[12:], defaultBlockRows)
+	binary.LittleEndian.PutUint32(header[16:], uint32(count))
+	for i, offset := range offsets {
+		binary.LittleEndian.PutUint64(header[blockHeaderSize+i*8:], offset)
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		if _, err := w.Write(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBlocks reads block compressed tile and returns decompressed content in hgt format
+func readBlocks(r io.Reader) ([]byte, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	t, err := openBlockTile(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+	return t.raw()
+}
+
+// blockSize returns size of raw tile from header of block compressed tile file
+func blockSize(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	t, err := openBlockTile(f, info.Size())
+	if err != nil {
+		return 0, errors.Wrapf(err, "block tile %s", path)
+	}
+	return t.rawSize(), nil
+}
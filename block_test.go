@@ -0,0 +1,89 @@
+package srtm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testRaw(t testing.TB) []byte {
+	f, err := os.Open(filepath.Join("testdata", "S46W066.hgt.gz"))
+	require.NoError(t, err)
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	raw, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	return raw
+}
+
+func TestBlocks(t *testing.T) {
+	raw := testRaw(t)
+	var buf bytes.Buffer
+	require.NoError(t, writeBlocks(&buf, raw, 0))
+	require.True(t, buf.Len() < len(raw)/4)
+	decoded, err := readBlocks(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, raw, decoded)
+
+	b, err := openBlockTile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Equal(t, 3601, b.size)
+	for _, idx := range []int{0, 1, 3601*16 - 1, 3601 * 16, 3601*3601 - 1, 1234567} {
+		e, err := b.elevation(idx)
+		require.NoError(t, err)
+		require.Equal(t, int16(uint16(raw[idx*2])<<8|uint16(raw[idx*2+1])), e)
+	}
+	require.True(t, b.memSize() < uint64(blockCacheSize*defaultBlockRows*3601*2+4096))
+}
+
+func TestBlocks_Corrupt(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeBlocks(&buf, make([]byte, 1201*1201*2), 0))
+	b := buf.Bytes()
+	_, err := openBlockTile(bytes.NewReader(b[:len(b)-1]), int64(len(b)-1))
+	require.Error(t, err)
+	corrupt := append([]byte{}, b...)
+	copy(corrupt, "HGTX")
+	_, err = openBlockTile(bytes.NewReader(corrupt), int64(len(corrupt)))
+	require.Error(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "N10E010.hgt.blk"), b[:len(b)-1], 0644))
+	data, err := NewWithOptions(WithTileDirectory(dir), WithExpiration(-1), WithOffline(true))
+	require.NoError(t, err)
+	defer data.Destroy()
+	_, err = data.AddElevation([]float64{10.5, 10.5})
+	require.ErrorIs(t, err, ErrCorruptTile)
+}
+
+func TestBlocks_Tile(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	require.NoError(t, writeBlocks(&buf, testRaw(t), 0))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "S46W066.hgt.blk"), buf.Bytes(), 0644))
+	data, err := NewWithOptions(WithTileDirectory(dir), WithExpiration(-1), WithOffline(true))
+	require.NoError(t, err)
+	defer data.Destroy()
+	expected, err := NewWithOptions(WithTileDirectory("testdata"), WithExpiration(-1), WithOffline(true))
+	require.NoError(t, err)
+	defer expected.Destroy()
+	for lat := -45.99; lat < -45; lat += 0.13 {
+		for lng := -65.99; lng < -65; lng += 0.17 {
+			e, err := expected.AddElevation([]float64{lng, lat})
+			require.NoError(t, err)
+			p, err := data.AddElevation([]float64{lng, lat})
+			require.NoError(t, err)
+			require.Equal(t, e, p)
+		}
+	}
+	stats := data.Stats()
+	require.Equal(t, 1, len(stats.Tiles))
+	require.Equal(t, FormatHGTBlock, stats.Tiles[0].Format)
+	require.True(t, stats.Tiles[0].Bytes < 4<<20)
+}
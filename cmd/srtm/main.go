@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/asmyasnikov/srtm"
+)
+
+const usage = `Usage: srtm [flags] <command> [args]
+
+Commands:
+  lookup <lat> <lng>          print elevation of location
+  geojson < in.json           add elevations to geojson object from stdin
+  fetch -bbox <bbox>          download missing tiles of bbox into tile directory
+  info <tile>                 print meta information and statistics of tile file
+  convert <input> <output>    convert tile file between hgt, hgt.gz, hgt.zst and hgt.blk formats
+                              (output is a tile file name or directory for hgt file)
+  compact -format <format>    convert tile directory into hgt, hgt.gz, hgt.zst or hgt.blk format
+  verify [-quarantine]        check tiles of tile directory against checksum manifest
+
+Flags:
+`
+
+var (
+	tileDirectory = flag.String("tile-directory", "./data/", "directory of hgt tiles")
+	download      = flag.Bool("download", true, "boolean flag for auto-download of missing tiles")
+	geoidFile     = flag.String("geoid-file", "", "geoid grid in GeographicLib pgm format (egm96-15.pgm) for ellipsoidal heights")
+	datum         = flag.String("datum", "egm96", "vertical datum of elevations (egm96 or wgs84)")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0), flag.Args()[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "srtm:", err)
+		os.Exit(1)
+	}
+}
+
+func run(command string, args []string, stdin io.Reader, stdout io.Writer) error {
+	switch command {
+	case "lookup":
+		return lookup(args, stdout)
+	case "geojson":
+		return addElevations(stdin, stdout)
+	case "fetch":
+		return fetch(args, stdout)
+	case "info":
+		return info(args, stdout)
+	case "convert":
+		return convert(args)
+	case "compact":
+		return compactTiles(args, stdout)
+	case "verify":
+		return verify(args, stdout)
+	default:
+		return fmt.Errorf("unknown command '%s'", command)
+	}
+}
+
+func newSRTM() (*srtm.SRTM, srtm.Datum, error) {
+	d, err := srtm.ParseDatum(*datum)
+	if err != nil {
+		return nil, d, err
+	}
+	opts := []srtm.Option{
+		srtm.WithTileDirectory(*tileDirectory),
+		srtm.WithDownload(*download),
+		srtm.WithExpiration(0),
+	}
+	if len(*geoidFile) > 0 {
+		geoid, err := srtm.LoadGeoid(*geoidFile)
+		if err != nil {
+			return nil, d, err
+		}
+		opts = append(opts, srtm.WithGeoid(geoid))
+	}
+	data, err := srtm.NewWithOptions(opts...)
+	return data, d, err
+}
+
+func lookup(args []string, stdout io.Writer) error {
+	if len(args) != 2 {
+		return fmt.Errorf("lookup requires <lat> <lng>")
+	}
+	lat, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return err
+	}
+	lng, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return err
+	}
+	data, d, err := newSRTM()
+	if err != nil {
+		return err
+	}
+	defer data.Destroy()
+	point, err := data.AddElevationWithDatum([]float64{lng, lat}, d)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "%.1f\n", point[2])
+	return err
+}
+
+func addElevations(stdin io.Reader, stdout io.Writer) error {
+	body, err := ioutil.ReadAll(stdin)
+	if err != nil {
+		return err
+	}
+	data, d, err := newSRTM()
+	if err != nil {
+		return err
+	}
+	defer data.Destroy()
+	body, err = data.AddElevationsJSON(body, false, d)
+	if body != nil {
+		if _, err := stdout.Write(body); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout)
+	}
+	return err
+}
+
+func fetch(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	bbox := fs.String("bbox", "", "bbox of tiles (minLng,minLat,maxLng,maxLat)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	b, err := srtm.ParseBBox(*bbox)
+	if err != nil {
+		return err
+	}
+	data, _, err := newSRTM()
+	if err != nil {
+		return err
+	}
+	defer data.Destroy()
+	if _, err := data.Fetch(context.Background(), b); err != nil {
+		return err
+	}
+	coverage, err := data.Coverage(b)
+	if err != nil {
+		return err
+	}
+	for _, t := range coverage.Tiles {
+		fmt.Fprintf(stdout, "%s\tpresent\t%s\n", t.Key, t.Path)
+	}
+	for _, key := range coverage.Missing {
+		fmt.Fprintf(stdout, "%s\tmissing\n", key)
+	}
+	for _, key := range coverage.Bads {
+		fmt.Fprintf(stdout, "%s\tbad\n", key)
+	}
+	return nil
+}
+
+func info(args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("info requires <tile>")
+	}
+	start := time.Now()
+	sw, size, elevations, err := srtm.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	read := time.Since(start)
+	min, max, sum, voids := math.MaxInt16, math.MinInt16, 0.0, 0
+	for _, e := range elevations {
+		if e == srtm.Void {
+			voids++
+			continue
+		}
+		if int(e) < min {
+			min = int(e)
+		}
+		if int(e) > max {
+			max = int(e)
+		}
+		sum += float64(e)
+	}
+	fmt.Fprintf(stdout, "south-west:  %s\n", sw.String())
+	fmt.Fprintf(stdout, "size:        %dx%d\n", size, size)
+	fmt.Fprintf(stdout, "resolution:  %d arcseconds\n", 3600/(size-1))
+	if valid := len(elevations) - voids; valid > 0 {
+		fmt.Fprintf(stdout, "min:         %d\n", min)
+		fmt.Fprintf(stdout, "max:         %d\n", max)
+		fmt.Fprintf(stdout, "mean:        %.1f\n", sum/float64(valid))
+	}
+	fmt.Fprintf(stdout, "voids:       %d (%.2f%%)\n", voids, float64(voids)*100/float64(len(elevations)))
+	fmt.Fprintf(stdout, "read time:   %s\n", read)
+	return nil
+}
+
+func convert(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("convert requires <input> <output>")
+	}
+	sw, _, elevations, err := srtm.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	_, err = srtm.WriteFile(args[1], *sw, elevations)
+	return err
+}
+
+func verify(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	quarantine := fs.Bool("quarantine", false, "move corrupt tiles into quarantine directory")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	data, _, err := newSRTM()
+	if err != nil {
+		return err
+	}
+	defer data.Destroy()
+	tiles, err := data.Verify(*quarantine)
+	if err != nil {
+		return err
+	}
+	corrupt := 0
+	for _, t := range tiles {
+		if len(t.Error) > 0 {
+			corrupt++
+			fmt.Fprintf(stdout, "%s\tcorrupt\t%s\t%s\n", t.Key, t.Path, t.Error)
+			continue
+		}
+		fmt.Fprintf(stdout, "%s\tok\t%s\n", t.Key, t.Path)
+	}
+	if corrupt > 0 {
+		return fmt.Errorf("%d of %d tiles are corrupt", corrupt, len(tiles))
+	}
+	return nil
+}
+
+func compactTiles(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("compact", flag.ContinueOnError)
+	f := fs.String("format", "hgt.zst", "format of tiles (hgt, hgt.gz, hgt.zst or hgt.blk)")
+	level := fs.Int("level", 0, "compression level (gzip 1-9, zstd 1-22, 0 for default)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	format, err := srtm.ParseTileFormat(*f)
+	if err != nil {
+		return err
+	}
+	data, _, err := newSRTM()
+	if err != nil {
+		return err
+	}
+	defer data.Destroy()
+	tiles, err := data.Compact(context.Background(), format, *level)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, t := range tiles {
+		if len(t.Error) > 0 {
+			failed++
+			fmt.Fprintf(stdout, "%s\tfailed\t%s\t%s\n", t.Key, t.Path, t.Error)
+			continue
+		}
+		fmt.Fprintf(stdout, "%s\t%s\t%s\t%d\n", t.Key, t.Format, t.Path, t.Bytes)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tiles are not converted", failed, len(tiles))
+	}
+	return nil
+}
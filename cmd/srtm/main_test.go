@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testTileDirectory returns tile directory with copy of testdata tile S46W066.hgt.gz
+func testTileDirectory(t *testing.T) string {
+	dir := t.TempDir()
+	b, err := ioutil.ReadFile(filepath.Join("..", "..", "testdata", "S46W066.hgt.gz"))
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "S46W066.hgt.gz"), b, 0644))
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		command string
+		args    func(dir string) []string
+		setup   func(t *testing.T, dir string)
+		output  []string
+		err     bool
+		check   func(t *testing.T, dir string)
+	}{
+		{
+			name:    "lookup",
+			command: "lookup",
+			args: func(string) []string {
+				return []string{"-45.02475838113942", "-65.92054637662613"}
+			},
+			output: []string{"24.9\n"},
+		},
+		{
+			name:    "lookup without longitude",
+			command: "lookup",
+			args: func(string) []string {
+				return []string{"-45.5"}
+			},
+			err: true,
+		},
+		{
+			name:    "lookup of missing tile",
+			command: "lookup",
+			args: func(string) []string {
+				return []string{"10.5", "10.5"}
+			},
+			err: true,
+		},
+		{
+			name:    "info",
+			command: "info",
+			args: func(dir string) []string {
+				return []string{filepath.Join(dir, "S46W066.hgt.gz")}
+			},
+			output: []string{
+				"south-west:  [-46.0000000, -66.0000000]",
+				"size:        3601x3601",
+				"resolution:  1 arcseconds",
+				"min:         -3",
+				"max:         146",
+				"voids:       0 (0.00%)",
+			},
+		},
+		{
+			name:    "info of invalid file",
+			command: "info",
+			args: func(dir string) []string {
+				return []string{filepath.Join(dir, "N10E010.hgt")}
+			},
+			setup: func(t *testing.T, dir string) {
+				require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "N10E010.hgt"), make([]byte, 1000), 0644))
+			},
+			err: true,
+		},
+		{
+			name:    "convert",
+			command: "convert",
+			args: func(dir string) []string {
+				return []string{filepath.Join(dir, "S46W066.hgt.gz"), filepath.Join(dir, "S46W066.hgt.blk")}
+			},
+			check: func(t *testing.T, dir string) {
+				var stdout bytes.Buffer
+				require.NoError(t, run("info", []string{filepath.Join(dir, "S46W066.hgt.blk")}, nil, &stdout))
+				require.Contains(t, stdout.String(), "max:         146")
+			},
+		},
+		{
+			name:    "convert into directory",
+			command: "convert",
+			args: func(dir string) []string {
+				return []string{filepath.Join(dir, "S46W066.hgt.gz"), dir}
+			},
+			check: func(t *testing.T, dir string) {
+				info, err := os.Stat(filepath.Join(dir, "S46W066.hgt"))
+				require.NoError(t, err)
+				require.Equal(t, int64(3601*3601*2), info.Size())
+			},
+		},
+		{
+			name:    "convert into invalid name",
+			command: "convert",
+			args: func(dir string) []string {
+				return []string{filepath.Join(dir, "S46W066.hgt.gz"), filepath.Join(dir, "N10E010.hgt")}
+			},
+			err: true,
+		},
+		{
+			name:    "verify",
+			command: "verify",
+			args: func(string) []string {
+				return nil
+			},
+			output: []string{"S46W066\tok\t"},
+		},
+		{
+			name:    "verify with corrupt tile",
+			command: "verify",
+			args: func(string) []string {
+				return []string{"-quarantine"}
+			},
+			setup: func(t *testing.T, dir string) {
+				require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "N10E010.hgt"), make([]byte, 1000), 0644))
+			},
+			output: []string{"S46W066\tok\t", "N10E010\tcorrupt\t"},
+			err:    true,
+			check: func(t *testing.T, dir string) {
+				_, err := os.Stat(filepath.Join(dir, "N10E010.hgt"))
+				require.True(t, os.IsNotExist(err))
+			},
+		},
+		{
+			name:    "fetch",
+			command: "fetch",
+			args: func(string) []string {
+				return []string{"-bbox", "-65.9,-45.9,-64.1,-45.1"}
+			},
+			output: []string{"S46W066\tpresent\t", "S46W065\tmissing"},
+		},
+		{
+			name:    "unknown command",
+			command: "unknown",
+			args: func(string) []string {
+				return nil
+			},
+			err: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testTileDirectory(t)
+			*tileDirectory = dir
+			*download = false
+			if tt.setup != nil {
+				tt.setup(t, dir)
+			}
+			var stdout bytes.Buffer
+			err := run(tt.command, tt.args(dir), strings.NewReader(""), &stdout)
+			if tt.err {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			for _, s := range tt.output {
+				require.Contains(t, stdout.String(), s)
+			}
+			if tt.check != nil {
+				tt.check(t, dir)
+			}
+		})
+	}
+}
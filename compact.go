@@ -0,0 +1,117 @@
+package srtm
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Compact converts tile files of tile directory into format with compression level
+// (gzip 1-9, zstd 1-22, zero is a default level of format). Compressed tiles take less
+// disk and are read fully into memory, raw tiles are read lazily from disk.
+// Tiles of same format are converted only with non-zero level. Compact returns
+// information about tiles after conversion, tiles which can't be converted have Error.
+// Compact can be called in background and stops on cancel of ctx or Destroy (with context.Canceled)
+func (d *SRTM) Compact(ctx context.Context, format TileFormat, level int) ([]TileInfo, error) {
+	tiles, err := d.Inventory()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]TileInfo, 0, len(tiles))
+	done := make(map[string]bool, len(tiles))
+	for _, t := range tiles {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		select {
+		case <-d.done:
+			return result, context.Canceled
+		default:
+		}
+		// only tile file which is used by loadTile is converted
+		if done[t.Key] {
+			continue
+		}
+		done[t.Key] = true
+		if len(t.Error) > 0 || (t.Format == format && (format == FormatHGT || level == 0)) {
+			result = append(result, t)
+			continue
+		}
+		c, err := d.compactTile(t, format, level)
+		if err != nil {
+			d.log.Error("compact tile", "tile path", t.Path, "format", format, "error", err)
+			t.Error = err.Error()
+			result = append(result, t)
+			continue
+		}
+		d.log.Info("compact tile", "tile path", t.Path, "result path", c.Path, "bytes", t.Bytes, "result bytes", c.Bytes)
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// compactTile converts tile file into format and replaces it in tile directory
+func (d *SRTM) compactTile(t TileInfo, format TileFormat, level int) (TileInfo, error) {
+	l, err := lock(filepath.Join(d.tileDirectory, "."+t.Key+".lock"), lockTimeout)
+	if err != nil {
+		return t, err
+	}
+	defer l.unlock()
+	info, err := os.Stat(t.Path)
+	if err != nil {
+		return t, err
+	}
+	if err := d.manifest.verify(t.Path, info, false); err != nil {
+		return t, err
+	}
+	f, err := os.Open(t.Path)
+	if err != nil {
+		return t, err
+	}
+	defer f.Close()
+	r, err := decompress(t.Format, f)
+	if err != nil {
+		return t, err
+	}
+	defer r.Close()
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return t, err
+	}
+	if _, _, err := Meta(t.Path, int64(len(raw))); err != nil {
+		return t, err
+	}
+	dest := filepath.Join(d.tileDirectory, t.Key+"."+string(format))
+	tmp, err := ioutil.TempFile(d.tileDirectory, ".compact-*")
+	if err != nil {
+		return t, err
+	}
+	defer os.Remove(tmp.Name())
+	if err := compress(format, level, raw, tmp); err != nil {
+		tmp.Close()
+		return t, err
+	}
+	if err := install(tmp, dest); err != nil {
+		return t, err
+	}
+	if dest != t.Path {
+		if err := os.Remove(t.Path); err != nil {
+			return t, err
+		}
+	}
+	if err := d.manifest.replace(filepath.Base(t.Path), dest); err != nil {
+		d.log.Error("manifest", "tile path", dest, "error", err)
+	}
+	// cached tile is loaded again from converted file
+	d.mtx.Lock()
+	d.cache.Remove(t.Key)
+	d.mtx.Unlock()
+	info, err = os.Stat(dest)
+	if err != nil {
+		return t, err
+	}
+	c := tileInfo(dest, info)
+	c.Source = t.Source
+	return c, nil
+}
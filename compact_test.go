@@ -0,0 +1,114 @@
+package srtm
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompact(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTile(t, dir, "N10E010", 100)
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "S46W066.hgt.gz"))
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "S46W066.hgt.gz"), b, 0644))
+	data, err := NewWithOptions(
+		WithTileDirectory(dir),
+		WithExpiration(-1),
+		WithOffline(true),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	require.NoError(t, data.manifest.record(filepath.Join(dir, "S46W066.hgt.gz"), "skadi"))
+	points := [][]float64{{10.5, 10.5}, {-65.5, -45.5}}
+	expected := make([]float64, len(points))
+	for i, p := range points {
+		point, err := data.AddElevation(p)
+		require.NoError(t, err)
+		expected[i] = point[2]
+	}
+	for _, c := range []struct {
+		format TileFormat
+		level  int
+		paths  []string
+	}{
+		{format: FormatHGTZstd, level: 3, paths: []string{"N10E010.hgt.zst", "S46W066.hgt.zst"}},
+		{format: FormatHGTGzip, level: 9, paths: []string{"N10E010.hgt.gz", "S46W066.hgt.gz"}},
+		{format: FormatHGTBlock, level: 1, paths: []string{"N10E010.hgt.blk", "S46W066.hgt.blk"}},
+		{format: FormatHGT, paths: []string{"N10E010.hgt", "S46W066.hgt"}},
+	} {
+		t.Run(string(c.format), func(t *testing.T) {
+			tiles, err := data.Compact(context.Background(), c.format, c.level)
+			require.NoError(t, err)
+			require.Equal(t, 2, len(tiles))
+			for i, tile := range tiles {
+				require.Empty(t, tile.Error)
+				require.Equal(t, c.format, tile.Format)
+				require.Equal(t, filepath.Join(dir, c.paths[i]), tile.Path)
+			}
+			require.Equal(t, 3, tiles[0].Resolution)
+			require.Equal(t, 1, tiles[1].Resolution)
+			require.Equal(t, "skadi", tiles[1].Source)
+			inventory, err := data.Inventory()
+			require.NoError(t, err)
+			require.Equal(t, tiles, inventory)
+			for i, p := range points {
+				point, err := data.AddElevation(p)
+				require.NoError(t, err)
+				require.Equal(t, expected[i], point[2])
+			}
+			verified, err := data.Verify(false)
+			require.NoError(t, err)
+			for _, tile := range verified {
+				require.Empty(t, tile.Error)
+			}
+		})
+	}
+}
+
+func TestCompact_Cancel(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTile(t, dir, "N10E010", 100)
+	data, err := NewWithOptions(WithTileDirectory(dir), WithExpiration(-1), WithOffline(true))
+	require.NoError(t, err)
+	defer data.Destroy()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = data.Compact(ctx, FormatHGTZstd, 0)
+	require.ErrorIs(t, err, context.Canceled)
+	_, err = os.Stat(filepath.Join(dir, "N10E010.hgt"))
+	require.NoError(t, err)
+}
+
+func TestCompact_Destroy(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTile(t, dir, "N10E010", 100)
+	data, err := NewWithOptions(WithTileDirectory(dir), WithExpiration(-1), WithOffline(true))
+	require.NoError(t, err)
+	data.Destroy()
+	_, err = data.Compact(context.Background(), FormatHGTZstd, 0)
+	require.ErrorIs(t, err, context.Canceled)
+	_, err = os.Stat(filepath.Join(dir, "N10E010.hgt"))
+	require.NoError(t, err)
+}
+
+func TestParseTileFormat(t *testing.T) {
+	for s, expected := range map[string]TileFormat{
+		"hgt":      FormatHGT,
+		"gz":       FormatHGTGzip,
+		"hgt.gz":   FormatHGTGzip,
+		"zstd":     FormatHGTZstd,
+		".hgt.zst": FormatHGTZstd,
+		"hgt.blk":  FormatHGTBlock,
+	} {
+		format, err := ParseTileFormat(s)
+		require.NoError(t, err)
+		require.Equal(t, expected, format)
+	}
+	_, err := ParseTileFormat("bz2")
+	require.Error(t, err)
+}
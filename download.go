@@ -0,0 +1,299 @@
+package srtm
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrDownloadTooLarge is returned when downloaded archive or extracted tile
+// exceeds size limit
+var ErrDownloadTooLarge = errors.New("download too large")
+
+const (
+	defaultDownloadConcurrency = 2
+	defaultDownloadRetries     = 3
+	defaultDownloadBackoff     = time.Second
+	// timeout of whole request including reading of archive
+	defaultDownloadTimeout = 5 * time.Minute
+	// 1 arcsecond tile is 25.9 MB, archives of imagico contains up to
+	// several dozens of 3 arcseconds tiles
+	defaultMaxDownloadSize = 1 << 30
+)
+
+// call is an in-flight download of url shared between callers
+type call struct {
+	done      chan struct{}
+	extracted []string
+	err       error
+}
+
+// downloader downloads tiles from providers with bounded parallelism, retries
+// and deduplication of concurrent downloads of the same url
+type downloader struct {
+	client    *http.Client
+	providers []Provider
+	sem       chan struct{}
+	retries   int
+	backoff   time.Duration
+	maxSize   int64
+	log       Logger
+	manifest  *manifest
+	mtx       sync.Mutex
+	inflight  map[string]*call
+}
+
+func newDownloader(client *http.Client, providers []Provider, m *manifest, concurrency, retries int, maxSize int64, log Logger) *downloader {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &downloader{
+		client:    client,
+		providers: providers,
+		sem:       make(chan struct{}, concurrency),
+		retries:   retries,
+		backoff:   defaultDownloadBackoff,
+		maxSize:   maxSize,
+		log:       log,
+		manifest:  m,
+		inflight:  make(map[string]*call),
+	}
+}
+
+// retryable returns true for errors of temporary server state
+func retryable(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// get makes GET request with retries and exponential backoff. Caller must close body
+func (d *downloader) get(client *http.Client, url string) (*http.Response, error) {
+	var err error
+	for attempt := 0; attempt <= d.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(d.backoff << uint(attempt-1))
+		}
+		var r *http.Response
+		r, err = client.Get(url)
+		if err != nil {
+			d.log.Warn("GET", "url", url, "attempt", attempt, "error", err)
+			continue
+		}
+		if r.StatusCode == http.StatusOK {
+			return r, nil
+		}
+		r.Body.Close()
+		err = fmt.Errorf("status code for request '%s' is not Ok (%d)", url, r.StatusCode)
+		if !retryable(r.StatusCode) {
+			return nil, err
+		}
+		d.log.Warn("GET", "url", url, "attempt", attempt, "error", err)
+	}
+	return nil, err
+}
+
+// once calls f with bounded parallelism. Concurrent calls with the same url share one call of f
+func (d *downloader) once(url string, f func() ([]string, error)) ([]string, error) {
+	d.mtx.Lock()
+	if c, ok := d.inflight[url]; ok {
+		d.mtx.Unlock()
+		<-c.done
+		return c.extracted, c.err
+	}
+	c := &call{
+		done: make(chan struct{}),
+	}
+	d.inflight[url] = c
+	d.mtx.Unlock()
+
+	d.sem <- struct{}{}
+	c.extracted, c.err = f()
+	<-d.sem
+
+	d.mtx.Lock()
+	delete(d.inflight, url)
+	d.mtx.Unlock()
+	close(c.done)
+	return c.extracted, c.err
+}
+
+// fetchZip downloads zip archive and extracts tiles into tileDir
+func (d *downloader) fetchZip(client *http.Client, tileDir, url string) ([]string, error) {
+	return d.once(url, func() ([]string, error) {
+		return d.downloadZip(client, tileDir, url)
+	})
+}
+
+// fetchFile downloads file into dest. Existing tile of dest is not overwritten
+func (d *downloader) fetchFile(client *http.Client, url, dest string) ([]string, error) {
+	return d.once(url, func() ([]string, error) {
+		if _, _, err := findKey(filepath.Dir(dest), filepath.Base(dest)[:7]); err == nil {
+			return nil, nil
+		}
+		tmp, _, err := d.downloadTemp(client, filepath.Dir(dest), url)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmp.Name())
+		if err := install(tmp, dest); err != nil {
+			return nil, err
+		}
+		return []string{dest}, nil
+	})
+}
+
+// downloadTemp streams response body into temporary file in dir with size limit.
+// Caller must close and remove file
+func (d *downloader) downloadTemp(client *http.Client, dir, url string) (*os.File, int64, error) {
+	r, err := d.get(client, url)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer r.Body.Close()
+	if r.ContentLength > d.maxSize {
+		return nil, 0, errors.Wrapf(ErrDownloadTooLarge, "url '%s' has content length %d (limit %d)", url, r.ContentLength, d.maxSize)
+	}
+	tmp, err := ioutil.TempFile(dir, ".download-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	n, err := io.Copy(tmp, io.LimitReader(r.Body, d.maxSize+1))
+	if err == nil && n > d.maxSize {
+		err = errors.Wrapf(ErrDownloadTooLarge, "url '%s' (limit %d)", url, d.maxSize)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, 0, errors.Wrapf(err, "download '%s'", url)
+	}
+	return tmp, n, nil
+}
+
+// downloadZip streams zip archive into temporary file and extracts tiles
+func (d *downloader) downloadZip(client *http.Client, tileDir, url string) ([]string, error) {
+	tmp, n, err := d.downloadTemp(client, tileDir, url)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	zr, err := zip.NewReader(tmp, n)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unzip '%s'", url)
+	}
+	extracted := make([]string, 0)
+	// seen contains keys of tiles of archive, only first entry of each tile is extracted
+	seen := make(map[string]struct{})
+	// total is a size of files extracted from archive
+	total := int64(0)
+	for _, file := range zr.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		name, ok := sanitize(file.Name)
+		if !ok {
+			d.log.Debug("skip file of archive", "url", url, "file", file.Name)
+			continue
+		}
+		if _, ok := seen[name[:7]]; ok {
+			d.log.Debug("skip duplicate tile of archive", "url", url, "file", file.Name)
+			continue
+		}
+		seen[name[:7]] = struct{}{}
+		// existing tiles (user provided or downloaded before) are never overwritten
+		if tPath, _, err := findKey(tileDir, name[:7]); err == nil {
+			d.log.Debug("skip existing tile of archive", "url", url, "file", file.Name, "tile path", tPath)
+			continue
+		}
+		hgt := filepath.Join(tileDir, name)
+		n, err := d.extract(file, hgt, d.maxSize-total)
+		if err != nil {
+			return extracted, errors.Wrapf(err, "extract '%s' from '%s'", file.Name, url)
+		}
+		total += n
+		extracted = append(extracted, hgt)
+	}
+	return extracted, nil
+}
+
+// sanitize returns base name of hgt file from archive. Directories of archive
+// are dropped, so file can't be extracted outside of tile directory (zip-slip)
+func sanitize(name string) (string, bool) {
+	name = path.Base(strings.Replace(name, "\\", "/", -1))
+	if srtmParseName.FindString(name) != name {
+		return "", false
+	}
+	return name, true
+}
+
+// extract writes file of archive to temporary file and installs it to dest.
+// limit is a size left for files of archive. extract returns size of file
+func (d *downloader) extract(file *zip.File, dest string, limit int64) (int64, error) {
+	if file.UncompressedSize64 > uint64(limit) {
+		return 0, errors.Wrapf(ErrDownloadTooLarge, "file size %d (limit %d left of %d)", file.UncompressedSize64, limit, d.maxSize)
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	tmp, err := ioutil.TempFile(filepath.Dir(dest), ".extract-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, io.LimitReader(rc, limit+1))
+	if err == nil && n > limit {
+		err = errors.Wrapf(ErrDownloadTooLarge, "file size (limit %d left of %d)", limit, d.maxSize)
+	}
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	return n, install(tmp, dest)
+}
+
+// download downloads tile of location from providers in priority order
+// and returns path of tile file. Download of tile is guarded by lock file
+// in tileDir, so processes sharing tileDir download each tile once
+func (d *downloader) download(tileDir string, ll LatLng) (string, os.FileInfo, error) {
+	key := tileKey(ll)
+	l, err := lock(filepath.Join(tileDir, "."+key+".lock"), lockTimeout)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "lock download of tile %s", key)
+	}
+	defer l.unlock()
+	if tPath, info, err := findTile(tileDir, ll); err == nil {
+		d.log.Debug("download", "key", key, "tile path", tPath, "message", "downloaded by other process")
+		return tPath, info, nil
+	}
+	errs := make([]string, 0, len(d.providers))
+	for _, p := range d.providers {
+		extracted, err := p.download(d, tileDir, ll)
+		for _, path := range extracted {
+			if err := d.manifest.record(path, p.Name()); err != nil {
+				d.log.Error("manifest", "tile path", path, "error", err)
+			}
+		}
+		if err != nil {
+			d.log.Warn("download", "provider", p.Name(), "key", key, "error", err)
+			errs = append(errs, p.Name()+": "+err.Error())
+			continue
+		}
+		if tPath, info, err := findTile(tileDir, ll); err == nil {
+			d.log.Info("download", "provider", p.Name(), "key", key, "tile path", tPath)
+			return tPath, info, nil
+		}
+		errs = append(errs, p.Name()+": tile is not found in downloaded files")
+	}
+	return "", nil, errors.Wrapf(ErrTileNotFound, "tile file for key = %s is not downloaded (errors %+v)", key, errs)
+}
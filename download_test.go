@@ -0,0 +1,284 @@
+package srtm
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testZip(t testing.TB, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// testImagico returns stand-in of imagico service with archive on /J40.zip
+func testImagico(t testing.TB, archive []byte, failures int32, requests *int32) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/search":
+			fmt.Fprintf(w, `[{"name":"J40.zip","link":"%s/J40.zip"}]`, server.URL)
+		case "/J40.zip":
+			if atomic.AddInt32(requests, 1) <= failures {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+			w.Write(archive)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testImagicoProvider(server *httptest.Server) Provider {
+	return &imagicoProvider{
+		searchURL: server.URL + "/search?lon=%0.7f&lat=%0.7f&lonE=%0.7f&latE=%0.7f",
+	}
+}
+
+func testManifest(t testing.TB, dir string) *manifest {
+	m, err := loadManifest(dir)
+	require.NoError(t, err)
+	return m
+}
+
+func testDownloader(t testing.TB, server *httptest.Server) *downloader {
+	d := newDownloader(server.Client(), []Provider{testImagicoProvider(server)}, testManifest(t, t.TempDir()), 2, 2, 8<<20, NopLogger())
+	d.backoff = time.Millisecond
+	return d
+}
+
+func TestDownloader_Download(t *testing.T) {
+	dir := t.TempDir()
+	outside := filepath.Join(filepath.Dir(dir), "N10E011.hgt")
+	archive := testZip(t, map[string][]byte{
+		"J40/N10E010.hgt":       make([]byte, 1201*1201*2),
+		"../../N10E011.hgt":     []byte{1, 2},
+		"/etc/N10E012.hgt":      []byte{1, 2},
+		"J40/readme.txt":        []byte("readme"),
+		"..\\..\\N10E013.hgt":   []byte{1, 2},
+		"J40/N10E014.hgt.gz.sh": []byte{1, 2},
+	})
+	var requests int32
+	d := testDownloader(t, testImagico(t, archive, 1, &requests))
+	tPath, info, err := d.download(dir, LatLng{Latitude: 10.5, Longitude: 10.5})
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "N10E010.hgt"), tPath)
+	require.Equal(t, int64(1201*1201*2), info.Size())
+	require.Equal(t, int32(2), requests)
+	_, err = os.Stat(outside)
+	require.True(t, os.IsNotExist(err))
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	require.Equal(t, []string{"N10E010.hgt", "N10E011.hgt", "N10E012.hgt", "N10E013.hgt"}, names)
+}
+
+func TestDownloader_SkipExisting(t *testing.T) {
+	dir := t.TempDir()
+	user := writeTestTile(t, dir, "N10E011", 7)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "N10E012.hgt.gz"), []byte{1, 2}, 0644))
+	archive := testZip(t, map[string][]byte{
+		"J40/N10E010.hgt": make([]byte, 1201*1201*2),
+		"J40/N10E011.hgt": make([]byte, 1201*1201*2),
+		"J40/N10E012.hgt": make([]byte, 1201*1201*2),
+	})
+	var requests int32
+	d := testDownloader(t, testImagico(t, archive, 0, &requests))
+	_, _, err := d.download(dir, LatLng{Latitude: 10.5, Longitude: 10.5})
+	require.NoError(t, err)
+	b, err := ioutil.ReadFile(user)
+	require.NoError(t, err)
+	require.Equal(t, byte(7), b[1])
+	_, err = os.Stat(filepath.Join(dir, "N10E012.hgt"))
+	require.True(t, os.IsNotExist(err))
+	_, ok := d.manifest.get("N10E010.hgt")
+	require.True(t, ok)
+	_, ok = d.manifest.get("N10E011.hgt")
+	require.False(t, ok)
+}
+
+func TestDownloader_Retries(t *testing.T) {
+	var requests int32
+	server := testImagico(t, testZip(t, nil), 10, &requests)
+	d := testDownloader(t, server)
+	_, err := d.fetchZip(d.client, t.TempDir(), server.URL+"/J40.zip")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "503")
+	require.Equal(t, int32(3), requests)
+}
+
+func TestDownloader_NotFound(t *testing.T) {
+	var requests int32
+	server := testImagico(t, nil, 0, &requests)
+	d := testDownloader(t, server)
+	_, err := d.fetchZip(d.client, t.TempDir(), server.URL+"/missing.zip")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "404")
+}
+
+func TestDownloader_MaxSize(t *testing.T) {
+	var requests int32
+	server := testImagico(t, testZip(t, map[string][]byte{"N10E010.hgt": make([]byte, 1201*1201*2)}), 0, &requests)
+	d := testDownloader(t, server)
+	d.maxSize = 1024
+	dir := t.TempDir()
+	_, err := d.fetchZip(d.client, dir, server.URL+"/J40.zip")
+	require.ErrorIs(t, err, ErrDownloadTooLarge)
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func TestDownloader_MaxSizeOfArchive(t *testing.T) {
+	var requests int32
+	// zeros are compressed, so archive is smaller than limit, but extracted tiles are not
+	server := testImagico(t, testZip(t, map[string][]byte{
+		"N10E010.hgt": make([]byte, 600),
+		"N10E011.hgt": make([]byte, 600),
+	}), 0, &requests)
+	d := testDownloader(t, server)
+	d.maxSize = 1000
+	dir := t.TempDir()
+	extracted, err := d.fetchZip(d.client, dir, server.URL+"/J40.zip")
+	require.ErrorIs(t, err, ErrDownloadTooLarge)
+	require.Equal(t, 1, len(extracted))
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(files))
+}
+
+func TestDownloader_DuplicateTile(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range []struct {
+		name    string
+		content []byte
+	}{
+		{"a/N10E010.hgt", []byte{1, 2}},
+		{"b/N10E010.hgt", []byte{3, 4}},
+		{"N10E010.HGT", []byte{5, 6}},
+	} {
+		w, err := zw.Create(f.name)
+		require.NoError(t, err)
+		_, err = w.Write(f.content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	var requests int32
+	server := testImagico(t, buf.Bytes(), 0, &requests)
+	d := testDownloader(t, server)
+	dir := t.TempDir()
+	extracted, err := d.fetchZip(d.client, dir, server.URL+"/J40.zip")
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "N10E010.hgt")}, extracted)
+	b, err := ioutil.ReadFile(filepath.Join(dir, "N10E010.hgt"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2}, b)
+}
+
+func TestDownloader_Dedup(t *testing.T) {
+	var requests int32
+	server := testImagico(t, testZip(t, map[string][]byte{"N10E010.hgt": []byte{1, 2}}), 0, &requests)
+	d := testDownloader(t, server)
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			extracted, err := d.fetchZip(d.client, dir, server.URL+"/J40.zip")
+			require.NoError(t, err)
+			require.Equal(t, []string{filepath.Join(dir, "N10E010.hgt")}, extracted)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), requests)
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"name":"J40.zip","link":"https://localhost/J40.zip"}]`)
+	}))
+	defer server.Close()
+	for _, tt := range []struct {
+		opts []Option
+		ok   bool
+	}{
+		{nil, false},
+		{[]Option{WithHTTPClient(server.Client())}, true},
+	} {
+		data, err := NewWithOptions(append(tt.opts, WithExpiration(-1), WithDownloadRetries(0))...)
+		require.NoError(t, err)
+		urls, err := testImagicoProvider(server).(*imagicoProvider).search(data.downloader, LatLng{Latitude: 10.5, Longitude: 10.5})
+		if tt.ok {
+			require.NoError(t, err)
+			require.Equal(t, []string{"https://localhost/J40.zip"}, urls)
+		} else {
+			require.Error(t, err)
+			require.Contains(t, err.Error(), "certificate")
+		}
+		data.Destroy()
+	}
+}
+
+func TestDownload_Unlocked(t *testing.T) {
+	var requests int32
+	dir := t.TempDir()
+	tile := make([]byte, 1201*1201*2)
+	archive := testZip(t, map[string][]byte{"C32/N10E010.hgt": tile})
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			close(started)
+		}
+		<-release
+		w.Write(archive)
+	}))
+	t.Cleanup(server.Close)
+	data := testSRTM(t, dir, server)
+	errs := make(chan error, 2)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := data.loadTile(LatLng{Latitude: 10.5, Longitude: 10.5})
+			errs <- err
+		}()
+	}
+	<-started
+	// tiles are loaded while other tile is downloading
+	writeTestTile(t, dir, "N20E020", 200)
+	point, err := data.AddElevation([]float64{20.5, 20.5})
+	require.NoError(t, err)
+	require.Equal(t, []float64{20.5, 20.5, 200}, point)
+	close(release)
+	for i := 0; i < cap(errs); i++ {
+		require.NoError(t, <-errs)
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,44 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/asmyasnikov/srtm"
+)
+
+// WriteASCIIGrid writes grid as ESRI ASCII grid. Nodes of grid are centers of cells
+func WriteASCIIGrid(w io.Writer, g *srtm.Grid) error {
+	bw := bufio.NewWriter(w)
+	bbox := g.BBox()
+	if _, err := fmt.Fprintf(bw,
+		"ncols %d\nnrows %d\nxllcenter %s\nyllcenter %s\ncellsize %s\nNODATA_value %d\n",
+		g.Cols,
+		g.Rows,
+		strconv.FormatFloat(bbox.SouthWest.Longitude, 'f', -1, 64),
+		strconv.FormatFloat(bbox.SouthWest.Latitude, 'f', -1, 64),
+		strconv.FormatFloat(g.CellSize, 'f', -1, 64),
+		srtm.Void,
+	); err != nil {
+		return err
+	}
+	b := make([]byte, 0, 8)
+	for row := 0; row < g.Rows; row++ {
+		for col := 0; col < g.Cols; col++ {
+			b = b[:0]
+			if col > 0 {
+				b = append(b, ' ')
+			}
+			b = strconv.AppendInt(b, int64(g.At(row, col)), 10)
+			if _, err := bw.Write(b); err != nil {
+				return err
+			}
+		}
+		if err := bw.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
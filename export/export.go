@@ -0,0 +1,28 @@
+// Package export provides writers of elevation grids into common GIS raster formats
+package export
+
+// Format is a raster format of exported grid
+type Format string
+
+const (
+	// GeoTIFF is a single band signed 16-bit GeoTIFF in WGS84 (EPSG:4326)
+	GeoTIFF Format = "tiff"
+	// ASCIIGrid is an ESRI ASCII grid (.asc)
+	ASCIIGrid Format = "asc"
+	// PNG is a 16-bit grayscale PNG with world file (.pgw)
+	PNG Format = "png"
+)
+
+// ParseFormat returns format by name or extension
+func ParseFormat(s string) (Format, bool) {
+	switch s {
+	case "tiff", "tif", "geotiff":
+		return GeoTIFF, true
+	case "asc", "ascii":
+		return ASCIIGrid, true
+	case "png":
+		return PNG, true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,75 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/asmyasnikov/srtm"
+	"github.com/stretchr/testify/require"
+)
+
+var grid = &srtm.Grid{
+	NorthWest: srtm.LatLng{
+		Latitude:  -45,
+		Longitude: -66,
+	},
+	CellSize:   0.5,
+	Rows:       2,
+	Cols:       3,
+	Elevations: []int16{1, 2, 3, -4, srtm.Void, 600},
+}
+
+func TestWriteASCIIGrid(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, WriteASCIIGrid(&b, grid))
+	require.Equal(t, "ncols 3\nnrows 2\nxllcenter -66\nyllcenter -45.5\ncellsize 0.5\nNODATA_value -32768\n1 2 3\n-4 -32768 600\n", b.String())
+}
+
+func TestWritePNG(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, WritePNG(&b, grid))
+	img, err := png.Decode(&b)
+	require.NoError(t, err)
+	gray, ok := img.(*image.Gray16)
+	require.True(t, ok)
+	require.Equal(t, image.Rect(0, 0, 3, 2), gray.Bounds())
+	require.Equal(t, uint16(3), gray.Gray16At(2, 0).Y)
+	require.Equal(t, uint16(0), gray.Gray16At(0, 1).Y)
+	require.Equal(t, uint16(600), gray.Gray16At(2, 1).Y)
+	b.Reset()
+	require.NoError(t, WriteWorldFile(&b, grid))
+	require.Equal(t, "0.5\n0\n0\n-0.5\n-66\n-45\n", b.String())
+}
+
+func TestWriteGeoTIFF(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, WriteGeoTIFF(&b, grid))
+	data := b.Bytes()
+	require.Equal(t, []byte{'I', 'I', 42, 0}, data[:4])
+	ifd := binary.LittleEndian.Uint32(data[4:])
+	n := int(binary.LittleEndian.Uint16(data[ifd:]))
+	tags := make(map[uint16][]byte, n)
+	prev := uint16(0)
+	for i := 0; i < n; i++ {
+		entry := data[int(ifd)+2+i*12:]
+		tag := binary.LittleEndian.Uint16(entry)
+		require.Greater(t, tag, prev)
+		prev = tag
+		tags[tag] = entry[8:12]
+	}
+	require.Equal(t, uint32(3), binary.LittleEndian.Uint32(tags[256]))
+	require.Equal(t, uint32(2), binary.LittleEndian.Uint32(tags[257]))
+	tiepoint := binary.LittleEndian.Uint32(tags[33922])
+	require.Equal(t, -66.0, math.Float64frombits(binary.LittleEndian.Uint64(data[tiepoint+24:])))
+	require.Equal(t, -45.0, math.Float64frombits(binary.LittleEndian.Uint64(data[tiepoint+32:])))
+	strip := binary.LittleEndian.Uint32(tags[273])
+	require.Equal(t, uint32(12), binary.LittleEndian.Uint32(tags[279]))
+	require.Equal(t, len(data), int(strip)+12)
+	for i, v := range grid.Elevations {
+		require.Equal(t, v, int16(binary.LittleEndian.Uint16(data[int(strip)+i*2:])))
+	}
+}
@@ -0,0 +1,141 @@
+package export
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/asmyasnikov/srtm"
+)
+
+const (
+	tiffShort  = 3
+	tiffLong   = 4
+	tiffDouble = 12
+	tiffASCII  = 2
+)
+
+type tiffEntry struct {
+	tag    uint16
+	typ    uint16
+	count  uint32
+	values []byte
+}
+
+func shorts(v ...uint16) []byte {
+	b := make([]byte, 2*len(v))
+	for i := range v {
+		binary.LittleEndian.PutUint16(b[i*2:], v[i])
+	}
+	return b
+}
+
+func longs(v ...uint32) []byte {
+	b := make([]byte, 4*len(v))
+	for i := range v {
+		binary.LittleEndian.PutUint32(b[i*4:], v[i])
+	}
+	return b
+}
+
+func doubles(v ...float64) []byte {
+	b := make([]byte, 8*len(v))
+	for i := range v {
+		binary.LittleEndian.PutUint64(b[i*8:], math.Float64bits(v[i]))
+	}
+	return b
+}
+
+// WriteGeoTIFF writes grid as single band signed 16-bit little-endian GeoTIFF
+// with georeferencing tags (EPSG:4326, pixel is point) and GDAL nodata tag
+func WriteGeoTIFF(w io.Writer, g *srtm.Grid) error {
+	nodata := []byte(strconv.Itoa(int(srtm.Void)) + "\x00")
+	entries := []tiffEntry{
+		{256, tiffLong, 1, longs(uint32(g.Cols))},
+		{257, tiffLong, 1, longs(uint32(g.Rows))},
+		{258, tiffShort, 1, shorts(16)},
+		{259, tiffShort, 1, shorts(1)},
+		{262, tiffShort, 1, shorts(1)},
+		{273, tiffLong, 1, nil}, // strip offset is filled below
+		{277, tiffShort, 1, shorts(1)},
+		{278, tiffLong, 1, longs(uint32(g.Rows))},
+		{279, tiffLong, 1, longs(uint32(g.Rows * g.Cols * 2))},
+		{284, tiffShort, 1, shorts(1)},
+		{339, tiffShort, 1, shorts(2)},
+		{33550, tiffDouble, 3, doubles(g.CellSize, g.CellSize, 0)},
+		{33922, tiffDouble, 6, doubles(0, 0, 0, g.NorthWest.Longitude, g.NorthWest.Latitude, 0)},
+		{34735, tiffShort, 16, shorts(
+			1, 1, 0, 3, // version, revision, minor revision, number of keys
+			1024, 0, 1, 2, // GTModelTypeGeoKey = ModelTypeGeographic
+			1025, 0, 1, 2, // GTRasterTypeGeoKey = RasterPixelIsPoint
+			2048, 0, 1, 4326, // GeographicTypeGeoKey = GCS_WGS_84
+		)},
+		{42113, tiffASCII, uint32(len(nodata)), nodata},
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].tag < entries[j].tag
+	})
+	const headerSize = 8
+	ifdSize := 2 + 12*len(entries) + 4
+	// values longer than 4 bytes are stored after IFD
+	offset := uint32(headerSize + ifdSize)
+	extra := make([]byte, 0)
+	stripOffset := func() uint32 {
+		return offset + uint32(len(extra))
+	}
+	for i := range entries {
+		if entries[i].tag == 273 {
+			continue
+		}
+		if len(entries[i].values) > 4 {
+			extra = append(extra, entries[i].values...)
+			if len(extra)%2 != 0 {
+				extra = append(extra, 0)
+			}
+		}
+	}
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write([]byte{'I', 'I', 42, 0}); err != nil {
+		return err
+	}
+	if _, err := bw.Write(longs(headerSize)); err != nil {
+		return err
+	}
+	if _, err := bw.Write(shorts(uint16(len(entries)))); err != nil {
+		return err
+	}
+	extraOffset := offset
+	for _, e := range entries {
+		if e.tag == 273 {
+			e.values = longs(stripOffset())
+		}
+		entry := append(shorts(e.tag, e.typ), longs(e.count)...)
+		if len(e.values) > 4 {
+			entry = append(entry, longs(extraOffset)...)
+			extraOffset += uint32(len(e.values) + len(e.values)%2)
+		} else {
+			entry = append(entry, e.values...)
+			entry = append(entry, make([]byte, 4-len(e.values))...)
+		}
+		if _, err := bw.Write(entry); err != nil {
+			return err
+		}
+	}
+	if _, err := bw.Write(longs(0)); err != nil {
+		return err
+	}
+	if _, err := bw.Write(extra); err != nil {
+		return err
+	}
+	b := make([]byte, 2)
+	for _, v := range g.Elevations {
+		binary.LittleEndian.PutUint16(b, uint16(v))
+		if _, err := bw.Write(b); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,42 @@
+package export
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strconv"
+
+	"github.com/asmyasnikov/srtm"
+)
+
+// WritePNG writes grid as 16-bit grayscale PNG. Gray level is elevation in meters.
+// Negative elevations and voids are written as 0
+func WritePNG(w io.Writer, g *srtm.Grid) error {
+	img := image.NewGray16(image.Rect(0, 0, g.Cols, g.Rows))
+	for row := 0; row < g.Rows; row++ {
+		for col := 0; col < g.Cols; col++ {
+			v := g.At(row, col)
+			if v < 0 {
+				v = 0
+			}
+			img.SetGray16(col, row, color.Gray16{Y: uint16(v)})
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// WriteWorldFile writes world file (.pgw) with georeferencing of image written by WritePNG
+func WriteWorldFile(w io.Writer, g *srtm.Grid) error {
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	_, err := fmt.Fprintf(w, "%s\n0\n0\n%s\n%s\n%s\n",
+		format(g.CellSize),
+		format(-g.CellSize),
+		format(g.NorthWest.Longitude),
+		format(g.NorthWest.Latitude),
+	)
+	return err
+}
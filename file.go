@@ -1,14 +1,17 @@
 package srtm
 
 import (
+	"bytes"
 	"compress/gzip"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"regexp"
 	"strings"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/pkg/errors"
 )
 
@@ -16,7 +19,117 @@ import (
 // pattern of a valid file which indicates lat/lon
 var ErrInvalidHGTFileName = errors.New("invalid HGT file name")
 
-var srtmParseName = regexp.MustCompile(`(N|S)(\d\d)(E|W)(\d\d\d)\.hgt(\.gz)?`)
+var srtmParseName = regexp.MustCompile(`(N|S)(\d\d)(E|W)(\d\d\d)\.hgt(\.gz|\.zst|\.blk)?`)
+
+// TileFormat is a storage format of tile file
+type TileFormat string
+
+const (
+	// FormatHGT is a raw big-endian HGT file, read lazily from disk
+	FormatHGT TileFormat = "hgt"
+	// FormatHGTGzip is a gzipped HGT file, read fully into memory
+	FormatHGTGzip TileFormat = "hgt.gz"
+	// FormatHGTZstd is a zstd compressed HGT file, read fully into memory
+	FormatHGTZstd TileFormat = "hgt.zst"
+	// FormatHGTBlock is a HGT file split into zstd compressed blocks of rows,
+	// blocks are read lazily from disk
+	FormatHGTBlock TileFormat = "hgt.blk"
+)
+
+// ParseTileFormat parses tile format (hgt, hgt.gz, hgt.zst or hgt.blk)
+func ParseTileFormat(s string) (TileFormat, error) {
+	switch strings.ToLower(strings.TrimPrefix(s, ".")) {
+	case "hgt", "raw":
+		return FormatHGT, nil
+	case "hgt.gz", "gz", "gzip":
+		return FormatHGTGzip, nil
+	case "hgt.zst", "zst", "zstd":
+		return FormatHGTZstd, nil
+	case "hgt.blk", "blk", "block":
+		return FormatHGTBlock, nil
+	default:
+		return "", fmt.Errorf("unknown tile format '%s' (hgt, hgt.gz, hgt.zst or hgt.blk)", s)
+	}
+}
+
+// tileFormat returns storage format of tile file by name
+func tileFormat(fname string) TileFormat {
+	switch {
+	case strings.HasSuffix(fname, ".gz"):
+		return FormatHGTGzip
+	case strings.HasSuffix(fname, ".zst"):
+		return FormatHGTZstd
+	case strings.HasSuffix(fname, ".blk"):
+		return FormatHGTBlock
+	default:
+		return FormatHGT
+	}
+}
+
+// compressed returns true for compressed formats
+func (f TileFormat) compressed() bool {
+	return f == FormatHGTGzip || f == FormatHGTZstd || f == FormatHGTBlock
+}
+
+// decompress returns reader of uncompressed content of tile file
+func decompress(format TileFormat, r io.Reader) (io.ReadCloser, error) {
+	switch format {
+	case FormatHGTGzip:
+		return gzip.NewReader(r)
+	case FormatHGTZstd:
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case FormatHGTBlock:
+		raw, err := readBlocks(r)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(raw)), nil
+	default:
+		return ioutil.NopCloser(r), nil
+	}
+}
+
+// compress writes raw content of tile file to w in format. level is a compression
+// level of gzip (1-9) or zstd (1-22, also for blocks), zero level is a default level of format
+func compress(format TileFormat, level int, raw []byte, w io.Writer) error {
+	switch format {
+	case FormatHGTGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		zw, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return err
+		}
+		if _, err := zw.Write(raw); err != nil {
+			zw.Close()
+			return err
+		}
+		return zw.Close()
+	case FormatHGTZstd:
+		l := zstd.SpeedDefault
+		if level != 0 {
+			l = zstd.EncoderLevelFromZstd(level)
+		}
+		zw, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(l), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return err
+		}
+		defer zw.Close()
+		// EncodeAll writes size of content into frame header
+		_, err = w.Write(zw.EncodeAll(raw, nil))
+		return err
+	case FormatHGTBlock:
+		return writeBlocks(w, raw, level)
+	default:
+		_, err := w.Write(raw)
+		return err
+	}
+}
 
 // ReadFile is a helper func around Read that reads a SRTM file, decompressing
 // if necessary, and returns  SRTM elevation data
@@ -27,19 +140,12 @@ func ReadFile(file string) (sw *LatLng, squareSize int, elevations []int16, err
 	}
 	defer f.Close()
 
-	if strings.HasSuffix(file, ".gz") {
-		rdr, err := gzip.NewReader(f)
-		if err != nil {
-			return sw, squareSize, elevations, err
-		}
-		defer rdr.Close()
-		bytes, err := ioutil.ReadAll(rdr)
-		if err != nil {
-			return sw, squareSize, elevations, err
-		}
-		return Read(file, bytes)
+	rdr, err := decompress(tileFormat(file), f)
+	if err != nil {
+		return sw, squareSize, elevations, err
 	}
-	bytes, err := ioutil.ReadAll(f)
+	defer rdr.Close()
+	bytes, err := ioutil.ReadAll(rdr)
 	if err != nil {
 		return sw, squareSize, elevations, err
 	}
@@ -48,14 +154,9 @@ func ReadFile(file string) (sw *LatLng, squareSize int, elevations []int16, err
 
 // Read reads elevation for points from a SRTM file
 func Read(fname string, bytes []byte) (sw *LatLng, squareSize int, elevations []int16, err error) {
-	if len(bytes) == 12967201*2 {
-		// 1 arcsecond
-		squareSize = 3601
-	} else if len(bytes) == 1442401*2 {
-		// 3 arcseconds
-		squareSize = 1201
-	} else {
-		return sw, squareSize, elevations, fmt.Errorf("hgt file cannot identified (only 1 arcsecond and 3 arcsecond supported, file size = %d)", len(bytes))
+	squareSize, err = tileSize(int64(len(bytes)))
+	if err != nil {
+		return sw, squareSize, elevations, err
 	}
 
 	sw, err = southWest(fname)
@@ -77,16 +178,25 @@ func Read(fname string, bytes []byte) (sw *LatLng, squareSize int, elevations []
 	return sw, squareSize, elevations, nil
 }
 
-// Meta reads meta information of SRTM file
-func Meta(fname string, size int64) (sw *LatLng, squareSize int, err error) {
-	if size == 12967201*2 {
+// tileSize returns size of tile by size of raw tile
+func tileSize(rawSize int64) (int, error) {
+	switch rawSize {
+	case 12967201 * 2:
 		// 1 arcsecond
-		squareSize = 3601
-	} else if size == 1442401*2 {
+		return 3601, nil
+	case 1442401 * 2:
 		// 3 arcseconds
-		squareSize = 1201
-	} else {
-		return sw, squareSize, fmt.Errorf("hgt file cannot identified (only 1 arcsecond and 3 arcsecond supported, file size = %d)", size)
+		return 1201, nil
+	default:
+		return 0, fmt.Errorf("hgt file cannot identified (only 1 arcsecond and 3 arcsecond supported, file size = %d)", rawSize)
+	}
+}
+
+// Meta reads meta information of SRTM file
+func Meta(fname string, size int64) (sw *LatLng, squareSize int, err error) {
+	squareSize, err = tileSize(size)
+	if err != nil {
+		return sw, squareSize, err
 	}
 	sw, err = southWest(fname)
 	return sw, squareSize, err
@@ -125,5 +235,13 @@ func IsHGT(fname string) bool {
 		return true
 	}
 
+	if strings.HasSuffix(fname, ".hgt.zst") {
+		return true
+	}
+
+	if strings.HasSuffix(fname, ".hgt.blk") {
+		return true
+	}
+
 	return false
 }
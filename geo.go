@@ -2,8 +2,10 @@ package srtm
 
 import (
 	"fmt"
+	"math"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -16,6 +18,10 @@ var latitudeDD = regexp.MustCompile(`N|S`)
 // unparsable or otherwise invalid
 var ErrInvalidCoordDegrees = errors.New("invalid lat/lon degrees")
 
+// ErrOutOfRange is returned when latitude/longitude is NaN, infinite or
+// latitude is outside [-90, 90]
+var ErrOutOfRange = errors.New("lat/lng is out of range")
+
 // LatLng represents a location
 type LatLng struct {
 	Latitude  float64
@@ -26,6 +32,24 @@ func (ll *LatLng) String() string {
 	return fmt.Sprintf("[%0.7f, %0.7f]", ll.Latitude, ll.Longitude)
 }
 
+// normalize checks location and wraps longitude into [-180, 180)
+func (ll LatLng) normalize() (LatLng, error) {
+	if math.IsNaN(ll.Latitude) || math.IsNaN(ll.Longitude) || math.IsInf(ll.Latitude, 0) || math.IsInf(ll.Longitude, 0) {
+		return ll, errors.Wrapf(ErrOutOfRange, "%s is not a number", ll.String())
+	}
+	if ll.Latitude < -90 || ll.Latitude > 90 {
+		return ll, errors.Wrapf(ErrOutOfRange, "latitude of %s must be between -90 and 90", ll.String())
+	}
+	if ll.Longitude < -180 || ll.Longitude >= 180 {
+		ll.Longitude = math.Mod(ll.Longitude+180, 360)
+		if ll.Longitude < 0 {
+			ll.Longitude += 360
+		}
+		ll.Longitude -= 180
+	}
+	return ll, nil
+}
+
 // dToDecimal accepts a direction-signed coordinate value (e.g. W|E or N|S prefix)
 // and returns a positive or negative number instead
 func dToDecimal(d string) (dd float64, err error) {
@@ -73,3 +97,81 @@ func dToDecimal(d string) (dd float64, err error) {
 
 	return dd, nil
 }
+
+// ErrInvalidBBox is returned when bounding box is unparsable or otherwise invalid
+var ErrInvalidBBox = errors.New("invalid bounding box")
+
+// BBox represents a rectangular area between south-west and north-east corners
+type BBox struct {
+	SouthWest LatLng
+	NorthEast LatLng
+}
+
+// ParseBBox parses bounding box from string "minLng,minLat,maxLng,maxLat"
+// (same order of values as bbox member of geojson)
+func ParseBBox(s string) (bbox BBox, err error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return bbox, errors.Wrapf(ErrInvalidBBox, "'%s' must contain 4 comma separated values", s)
+	}
+	values := make([]float64, 4)
+	for i, p := range parts {
+		values[i], err = strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return bbox, errors.Wrapf(ErrInvalidBBox, "could not parse '%s'", p)
+		}
+	}
+	bbox = BBox{
+		SouthWest: LatLng{
+			Latitude:  values[1],
+			Longitude: values[0],
+		},
+		NorthEast: LatLng{
+			Latitude:  values[3],
+			Longitude: values[2],
+		},
+	}
+	for _, ll := range []LatLng{bbox.SouthWest, bbox.NorthEast} {
+		if _, err := ll.normalize(); err != nil || ll.Longitude < -180 || ll.Longitude > 180 {
+			return bbox, errors.Wrapf(ErrInvalidBBox, "%s is out of range", ll.String())
+		}
+	}
+	if bbox.SouthWest.Latitude > bbox.NorthEast.Latitude || bbox.SouthWest.Longitude > bbox.NorthEast.Longitude {
+		return bbox, errors.Wrapf(ErrInvalidBBox, "south-west corner %s is not south-west of north-east corner %s", bbox.SouthWest.String(), bbox.NorthEast.String())
+	}
+	return bbox, nil
+}
+
+func (b *BBox) String() string {
+	return fmt.Sprintf("[%0.7f, %0.7f, %0.7f, %0.7f]", b.SouthWest.Longitude, b.SouthWest.Latitude, b.NorthEast.Longitude, b.NorthEast.Latitude)
+}
+
+// Area returns area of bounding box in square degrees
+func (b *BBox) Area() float64 {
+	return (b.NorthEast.Latitude - b.SouthWest.Latitude) * (b.NorthEast.Longitude - b.SouthWest.Longitude)
+}
+
+// Extend extends bounding box to contain point [longitude, latitude]
+func (b *BBox) Extend(point []float64) {
+	if len(point) < 2 {
+		return
+	}
+	b.SouthWest.Latitude = math.Min(b.SouthWest.Latitude, point[1])
+	b.SouthWest.Longitude = math.Min(b.SouthWest.Longitude, point[0])
+	b.NorthEast.Latitude = math.Max(b.NorthEast.Latitude, point[1])
+	b.NorthEast.Longitude = math.Max(b.NorthEast.Longitude, point[0])
+}
+
+// tiles returns south-west corners of all tiles intersecting with bounding box
+func (b *BBox) tiles() []LatLng {
+	tiles := make([]LatLng, 0)
+	for lat := math.Floor(b.SouthWest.Latitude); lat < b.NorthEast.Latitude || lat == b.SouthWest.Latitude; lat++ {
+		for lng := math.Floor(b.SouthWest.Longitude); lng < b.NorthEast.Longitude || lng == b.SouthWest.Longitude; lng++ {
+			tiles = append(tiles, LatLng{
+				Latitude:  lat,
+				Longitude: lng,
+			})
+		}
+	}
+	return tiles
+}
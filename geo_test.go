@@ -1,6 +1,7 @@
 package srtm
 
 import (
+	"math"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -29,3 +30,51 @@ func TestParseInvalidDirVals(t *testing.T) {
 		t.Errorf("parsing %s should throw error, instead got %s and value %f", v, err, res)
 	}
 }
+
+func TestNormalize(t *testing.T) {
+	for _, tt := range []struct {
+		in  LatLng
+		out LatLng
+	}{
+		{LatLng{Latitude: 10, Longitude: 180}, LatLng{Latitude: 10, Longitude: -180}},
+		{LatLng{Latitude: 10, Longitude: 190}, LatLng{Latitude: 10, Longitude: -170}},
+		{LatLng{Latitude: 10, Longitude: -181}, LatLng{Latitude: 10, Longitude: 179}},
+		{LatLng{Latitude: 10, Longitude: 540}, LatLng{Latitude: 10, Longitude: -180}},
+		{LatLng{Latitude: 90, Longitude: -180}, LatLng{Latitude: 90, Longitude: -180}},
+	} {
+		out, err := tt.in.normalize()
+		if err != nil {
+			t.Errorf("normalize %s: %s", tt.in.String(), err)
+		}
+		if out != tt.out {
+			t.Errorf("normalize %s: got %s, want %s", tt.in.String(), out.String(), tt.out.String())
+		}
+	}
+	for _, ll := range []LatLng{
+		{Latitude: math.NaN(), Longitude: 0},
+		{Latitude: 0, Longitude: math.Inf(1)},
+		{Latitude: 90.5, Longitude: 0},
+		{Latitude: -91, Longitude: 0},
+	} {
+		if _, err := ll.normalize(); errors.Cause(err) != ErrOutOfRange {
+			t.Errorf("normalize %s should return ErrOutOfRange, instead got %v", ll.String(), err)
+		}
+	}
+}
+
+func TestTileKey(t *testing.T) {
+	for _, tt := range []struct {
+		ll  LatLng
+		key string
+	}{
+		{LatLng{Latitude: 90, Longitude: 0}, "N89E000"},
+		{LatLng{Latitude: -0.5, Longitude: -0.5}, "S01W001"},
+		{LatLng{Latitude: 0, Longitude: 0}, "N00E000"},
+		{LatLng{Latitude: -45, Longitude: -66}, "S45W066"},
+		{LatLng{Latitude: 59.9999, Longitude: -180}, "N59W180"},
+	} {
+		if key := tileKey(tt.ll); key != tt.key {
+			t.Errorf("tileKey %s: got %s, want %s", tt.ll.String(), key, tt.key)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package srtm
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Datum is a vertical datum of elevations
+type Datum int
+
+const (
+	// DatumEGM96 is orthometric heights above EGM96 geoid (native datum of SRTM tiles)
+	DatumEGM96 Datum = iota
+	// DatumWGS84 is ellipsoidal heights above WGS84 ellipsoid (GPS receivers, Cesium)
+	DatumWGS84
+)
+
+// ErrNoGeoid is returned when ellipsoidal heights requested but geoid grid is not loaded
+var ErrNoGeoid = errors.New("geoid grid is not loaded")
+
+// ErrInvalidDatum is returned when datum name is unknown
+var ErrInvalidDatum = errors.New("invalid vertical datum")
+
+// ParseDatum returns datum by name. Empty name means DatumEGM96
+func ParseDatum(s string) (Datum, error) {
+	switch strings.ToLower(s) {
+	case "", "egm96", "geoid", "orthometric", "msl":
+		return DatumEGM96, nil
+	case "wgs84", "ellipsoid", "ellipsoidal":
+		return DatumWGS84, nil
+	default:
+		return DatumEGM96, errors.Wrapf(ErrInvalidDatum, "'%s' (supported egm96, wgs84)", s)
+	}
+}
+
+func (d Datum) String() string {
+	switch d {
+	case DatumEGM96:
+		return "egm96"
+	case DatumWGS84:
+		return "wgs84"
+	default:
+		return "unknown"
+	}
+}
+
+// Geoid is a global grid of geoid undulations (heights of geoid above WGS84 ellipsoid)
+type Geoid struct {
+	width  int
+	height int
+	offset float64
+	scale  float64
+	values []uint16
+}
+
+// LoadGeoid reads geoid grid from file in GeographicLib PGM format
+// (egm96-15.pgm, egm96-5.pgm, egm2008-1.pgm and other), decompressing if necessary
+func LoadGeoid(file string) (*Geoid, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if strings.HasSuffix(file, ".gz") {
+		rdr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer rdr.Close()
+		return ReadGeoid(rdr)
+	}
+	return ReadGeoid(f)
+}
+
+// ReadGeoid reads geoid grid in GeographicLib PGM format: 16-bit binary PGM with
+// "# Offset" and "# Scale" comments, rows from north pole to south pole and columns
+// from 0 longitude to east
+func ReadGeoid(r io.Reader) (*Geoid, error) {
+	rdr := bufio.NewReader(r)
+	g := &Geoid{
+		scale: 1,
+	}
+	header := make([]string, 0, 4)
+	for len(header) < 4 {
+		line, err := rdr.ReadString('\n')
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read pgm header")
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(strings.TrimPrefix(line, "#"))
+			if len(fields) != 2 {
+				continue
+			}
+			switch fields[0] {
+			case "Offset":
+				g.offset, err = strconv.ParseFloat(fields[1], 64)
+			case "Scale":
+				g.scale, err = strconv.ParseFloat(fields[1], 64)
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not parse pgm header '%s'", line)
+			}
+			continue
+		}
+		header = append(header, strings.Fields(line)...)
+	}
+	if header[0] != "P5" {
+		return nil, fmt.Errorf("geoid grid is not binary pgm (magic %s)", header[0])
+	}
+	values := make([]int, 3)
+	for i := range values {
+		v, err := strconv.Atoi(header[i+1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse pgm header '%s'", header[i+1])
+		}
+		values[i] = v
+	}
+	g.width, g.height = values[0], values[1]
+	if values[2] != 65535 {
+		return nil, fmt.Errorf("geoid grid is not 16-bit pgm (max value %d)", values[2])
+	}
+	if g.width < 2 || g.height < 2 || (g.height-1)*2 != g.width {
+		return nil, fmt.Errorf("geoid grid is not global (size %dx%d)", g.width, g.height)
+	}
+	g.values = make([]uint16, g.width*g.height)
+	if err := binary.Read(rdr, binary.BigEndian, g.values); err != nil {
+		return nil, errors.Wrap(err, "could not read geoid grid")
+	}
+	return g, nil
+}
+
+func (g *Geoid) value(row, col int) float64 {
+	if row >= g.height {
+		row = g.height - 1
+	}
+	return g.offset + g.scale*float64(g.values[row*g.width+col%g.width])
+}
+
+// Undulation returns height of geoid above WGS84 ellipsoid in meters
+func (g *Geoid) Undulation(ll LatLng) float64 {
+	step := 180 / float64(g.height-1)
+	lng := math.Mod(ll.Longitude, 360)
+	if lng < 0 {
+		lng += 360
+	}
+	row := (90 - math.Max(-90, math.Min(90, ll.Latitude))) / step
+	col := lng / step
+	rowLow := int(math.Floor(row))
+	colLow := int(math.Floor(col))
+	v1 := avg(g.value(rowLow, colLow), g.value(rowLow, colLow+1), col-float64(colLow))
+	v2 := avg(g.value(rowLow+1, colLow), g.value(rowLow+1, colLow+1), col-float64(colLow))
+	return avg(v1, v2, row-float64(rowLow))
+}
+
+// convert converts orthometric elevation into requested datum
+func (g *Geoid) convert(ll LatLng, elevation float64, datum Datum) (float64, error) {
+	switch datum {
+	case DatumEGM96:
+		return elevation, nil
+	case DatumWGS84:
+		if g == nil {
+			return elevation, ErrNoGeoid
+		}
+		return elevation + g.Undulation(ll), nil
+	default:
+		return elevation, errors.Wrapf(ErrInvalidDatum, "%d", datum)
+	}
+}
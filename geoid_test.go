@@ -0,0 +1,70 @@
+package srtm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func testGeoid(t *testing.T, values []uint16) *Geoid {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "P5\n# Description test geoid\n# Offset -100\n# Scale 0.5\n4 3\n65535\n")
+	require.NoError(t, binary.Write(&b, binary.BigEndian, values))
+	g, err := ReadGeoid(&b)
+	require.NoError(t, err)
+	return g
+}
+
+func TestGeoidUndulation(t *testing.T) {
+	g := testGeoid(t, []uint16{
+		200, 200, 200, 200,
+		0, 100, 200, 300,
+		400, 400, 400, 400,
+	})
+	require.Equal(t, 0., g.Undulation(LatLng{Latitude: 90, Longitude: 0}))
+	require.Equal(t, -100., g.Undulation(LatLng{Latitude: 0, Longitude: 0}))
+	require.Equal(t, -75., g.Undulation(LatLng{Latitude: 0, Longitude: 45}))
+	require.Equal(t, -75., g.Undulation(LatLng{Latitude: 0, Longitude: -315}))
+	// between 270 and 360 (=0) longitudes
+	require.Equal(t, -25., g.Undulation(LatLng{Latitude: 0, Longitude: -45}))
+	require.Equal(t, 100., g.Undulation(LatLng{Latitude: -90, Longitude: 10}))
+}
+
+func TestAddElevationWithDatum(t *testing.T) {
+	data, err := New(1, "testdata", -1)
+	require.NoError(t, err)
+	defer data.Destroy()
+	point := []float64{-65.92054637662613, -45.02475838113942}
+	_, err = data.AddElevationWithDatum(point, DatumWGS84)
+	require.True(t, errors.Is(err, ErrNoGeoid))
+	values := make([]uint16, 12)
+	for i := range values {
+		values[i] = 240
+	}
+	data.SetGeoid(testGeoid(t, values))
+	ellipsoidal, err := data.AddElevationWithDatum([]float64{point[0], point[1]}, DatumWGS84)
+	require.NoError(t, err)
+	orthometric, err := data.AddElevation([]float64{point[0], point[1]})
+	require.NoError(t, err)
+	require.Equal(t, 20., math.Round(ellipsoidal[2]-orthometric[2]))
+	data.SetDatum(DatumWGS84)
+	p, err := data.AddElevation([]float64{point[0], point[1]})
+	require.NoError(t, err)
+	require.Equal(t, ellipsoidal, p)
+}
+
+func TestParseDatum(t *testing.T) {
+	datum, err := ParseDatum("WGS84")
+	require.NoError(t, err)
+	require.Equal(t, DatumWGS84, datum)
+	datum, err = ParseDatum("")
+	require.NoError(t, err)
+	require.Equal(t, DatumEGM96, datum)
+	_, err = ParseDatum("navd88")
+	require.True(t, errors.Is(err, ErrInvalidDatum))
+}
@@ -1,120 +1,371 @@
 package srtm
 
 import (
-	geojson "github.com/paulmach/go.geojson"
-	"github.com/rs/zerolog/log"
-	"runtime"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	geojson "github.com/paulmach/go.geojson"
+	"github.com/pkg/errors"
 )
 
+// PointError is an error of adding elevation to one coordinate of geojson object
+type PointError struct {
+	// Path is an index path of coordinate inside geojson object. For example
+	// [feature, geometry of collection, polygon, ring, point]
+	Path []int
+	Err  error
+}
+
+func (e *PointError) Error() string {
+	path := make([]string, len(e.Path))
+	for i, idx := range e.Path {
+		path[i] = strconv.Itoa(idx)
+	}
+	return fmt.Sprintf("coordinate [%s]: %s", strings.Join(path, ","), e.Err.Error())
+}
+
+// Unwrap returns cause of error
+func (e *PointError) Unwrap() error {
+	return e.Err
+}
+
+// PointErrors is a list of errors of all failed coordinates of geojson object
+type PointErrors []*PointError
+
+func (e PointErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d coordinates failed: %s", len(e), strings.Join(messages, "; "))
+}
+
+// SetFillValue sets elevation for failed coordinates of AddElevations.
+// By default failed coordinates keeps original 2D coordinate
+func (d *SRTM) SetFillValue(fill float64) {
+	d.fill.Store(fill)
+}
+
 // AddElevation returns point with 3 coordinates: [longitude, latitude, elevation]
-// Param tileDir - directory of hgt-tiles
+// Elevation is relative to default datum of SRTM (see SetDatum)
 // Param point - [longitude, latitude]
 func (d *SRTM) AddElevation(point []float64) ([]float64, error) {
-	ll := LatLng{
+	return d.addElevation(point, d.getDatum())
+}
+
+// AddElevationWithDatum returns point with 3 coordinates: [longitude, latitude, elevation]
+// Elevation is relative to requested datum
+// Param point - [longitude, latitude]
+// Param datum - vertical datum of elevation
+func (d *SRTM) AddElevationWithDatum(point []float64, datum Datum) ([]float64, error) {
+	return d.addElevation(point, datum)
+}
+
+// pointLatLng returns normalized location of point [longitude, latitude]
+func pointLatLng(point []float64) (LatLng, error) {
+	if len(point) < 2 {
+		return LatLng{}, errors.Wrapf(ErrOutOfRange, "point %v must contain longitude and latitude", point)
+	}
+	return LatLng{
 		Latitude:  point[1],
 		Longitude: point[0],
+	}.normalize()
+}
+
+func (d *SRTM) addElevation(point []float64, datum Datum) ([]float64, error) {
+	ll, err := pointLatLng(point)
+	if err != nil {
+		return nil, err
 	}
 	tile, err := d.loadTile(ll)
 	if err != nil {
-		log.Error().Caller().Err(err).Msgf("loadTile: latLng = %s -> error %s", ll.String(), err.Error())
+		d.log.Error("loadTile", "latLng", ll.String(), "error", err)
+		return d.fallbackElevation(point, ll, datum, err)
+	}
+	return d.tileElevation(tile, point, ll, datum)
+}
+
+// fallbackElevation returns point with fallback elevation for location in missing
+// tile or err if fallback elevation is not set
+func (d *SRTM) fallbackElevation(point []float64, ll LatLng, datum Datum, err error) ([]float64, error) {
+	if d.fallback == nil || !errors.Is(err, ErrTileNotFound) {
 		return nil, err
 	}
+	elevation, err := d.getGeoid().convert(ll, *d.fallback, datum)
+	if err != nil {
+		d.log.Error("convert", "latLng", ll.String(), "datum", datum.String(), "error", err)
+		return nil, err
+	}
+	return append(point[:2], elevation), nil
+}
+
+func (d *SRTM) tileElevation(tile *Tile, point []float64, ll LatLng, datum Datum) ([]float64, error) {
 	tile.setLRU(time.Now())
 	elevation, err := tile.GetElevation(ll)
 	if err != nil {
-		log.Error().Caller().Err(err).Msgf("GetElevation: latLng = %s -> error %s", ll.String(), err.Error())
+		d.log.Error("GetElevation", "latLng", ll.String(), "error", err)
+		return nil, err
+	}
+	elevation, err = d.getGeoid().convert(ll, elevation, datum)
+	if err != nil {
+		d.log.Error("convert", "latLng", ll.String(), "datum", datum.String(), "error", err)
 		return nil, err
 	}
 	return append(point[:2], float64(elevation)), nil
 }
 
 // AddElevations returns geojson with added third coordinate (elevation)
-// Param tileDir - directory of hgt-tiles
+// Elevations are relative to default datum of SRTM (see SetDatum)
+// Failed coordinates keeps original 2D coordinate (or gets fill value, see SetFillValue)
 // Param geoJson - geojson for processing
-// Param skipErrors - if false AddElevations use premature exit (on first bad point in geojson). if true all points will be process but bad point will not to be contains elevation coordinate
+// Param skipErrors - if false AddElevations returns PointErrors with all failed coordinates. if true failed coordinates are ignored
 func (d *SRTM) AddElevations(geoJson *geojson.Geometry, skipErrors bool) error {
-	switch geoJson.Type {
-	case geojson.GeometryPoint:
-		point, err := d.AddElevation(geoJson.Point)
-		if err != nil && !skipErrors {
+	return d.addElevations(geoJson, skipErrors, d.getDatum())
+}
+
+// AddElevationsWithDatum returns geojson with added third coordinate (elevation)
+// Elevations are relative to requested datum
+// Param geoJson - geojson for processing
+// Param skipErrors - same as AddElevations
+// Param datum - vertical datum of elevations
+func (d *SRTM) AddElevationsWithDatum(geoJson *geojson.Geometry, skipErrors bool, datum Datum) error {
+	return d.addElevations(geoJson, skipErrors, datum)
+}
+
+func (d *SRTM) addElevations(geoJson *geojson.Geometry, skipErrors bool, datum Datum) error {
+	coordinates, err := collect(geoJson, nil, nil)
+	if err != nil {
+		return err
+	}
+	return d.process(coordinates, skipErrors, datum)
+}
+
+// AddElevationsFeature adds elevations to geometry of feature. Properties of feature are not changed
+// Param feature - geojson feature for processing
+// Param skipErrors - same as AddElevations
+func (d *SRTM) AddElevationsFeature(feature *geojson.Feature, skipErrors bool) error {
+	return d.addElevationsFeature(feature, skipErrors, d.getDatum())
+}
+
+func (d *SRTM) addElevationsFeature(feature *geojson.Feature, skipErrors bool, datum Datum) error {
+	if feature.Geometry == nil {
+		return nil
+	}
+	return d.addElevations(feature.Geometry, skipErrors, datum)
+}
+
+// AddElevationsFeatureCollection adds elevations to geometries of all features in collection
+// Param featureCollection - geojson feature collection for processing
+// Param skipErrors - same as AddElevations
+func (d *SRTM) AddElevationsFeatureCollection(featureCollection *geojson.FeatureCollection, skipErrors bool) error {
+	return d.addElevationsFeatureCollection(featureCollection, skipErrors, d.getDatum())
+}
+
+func (d *SRTM) addElevationsFeatureCollection(featureCollection *geojson.FeatureCollection, skipErrors bool, datum Datum) error {
+	coordinates := make([]coordinate, 0)
+	for i, feature := range featureCollection.Features {
+		if feature == nil || feature.Geometry == nil {
+			continue
+		}
+		var err error
+		coordinates, err = collect(feature.Geometry, []int{i}, coordinates)
+		if err != nil {
 			return err
 		}
-		geoJson.Point = point
-		return nil
-	case geojson.GeometryLineString:
-		d.process2(geoJson.LineString, runtime.NumCPU())
-		return nil
-	case geojson.GeometryMultiPoint:
-		d.process2(geoJson.MultiPoint, runtime.NumCPU())
-		return nil
-	case geojson.GeometryPolygon:
-		d.process3(geoJson.Polygon, runtime.NumCPU())
-		return nil
-	case geojson.GeometryMultiLineString:
-		d.process3(geoJson.MultiLineString, runtime.NumCPU())
-		return nil
-	default:
-		return nil
 	}
+	return d.process(coordinates, skipErrors, datum)
 }
 
-func (d *SRTM) process3(slice [][][]float64, n int) {
-	wg := sync.WaitGroup{}
-	wg.Add(n+1)
-	type p struct {
-		i int
-		j int
+// AddElevationsJSON adds elevations to any geojson object (geometry, Feature or FeatureCollection)
+// and returns encoded result. On PointErrors encoded result is returned with error
+// Param body - encoded geojson object
+// Param skipErrors - same as AddElevations
+// Param datum - vertical datum of elevations
+func (d *SRTM) AddElevationsJSON(body []byte, skipErrors bool, datum Datum) ([]byte, error) {
+	var object struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(body, &object); err != nil {
+		return nil, err
+	}
+	var (
+		result json.Marshaler
+		err    error
+	)
+	switch object.Type {
+	case "Feature":
+		feature, e := geojson.UnmarshalFeature(body)
+		if e != nil {
+			return nil, e
+		}
+		result, err = feature, d.addElevationsFeature(feature, skipErrors, datum)
+	case "FeatureCollection":
+		featureCollection, e := geojson.UnmarshalFeatureCollection(body)
+		if e != nil {
+			return nil, e
+		}
+		result, err = featureCollection, d.addElevationsFeatureCollection(featureCollection, skipErrors, datum)
+	default:
+		geometry, e := geojson.UnmarshalGeometry(body)
+		if e != nil {
+			return nil, e
+		}
+		result, err = geometry, d.addElevations(geometry, skipErrors, datum)
+	}
+	if _, ok := err.(PointErrors); err != nil && !ok {
+		return nil, err
+	}
+	body, e := result.MarshalJSON()
+	if e != nil {
+		return nil, e
 	}
-	ch := make(chan p, n)
-	go func() {
+	return body, err
+}
+
+// coordinate is a reference to coordinate slot inside geojson object
+type coordinate struct {
+	path  []int
+	point *[]float64
+}
+
+func childPath(path []int, idx ...int) []int {
+	child := make([]int, 0, len(path)+len(idx))
+	child = append(child, path...)
+	return append(child, idx...)
+}
+
+// collect appends references to all coordinates of geometry
+func collect(geometry *geojson.Geometry, path []int, coordinates []coordinate) ([]coordinate, error) {
+	switch geometry.Type {
+	case geojson.GeometryPoint:
+		coordinates = append(coordinates, coordinate{childPath(path), &geometry.Point})
+	case geojson.GeometryLineString, geojson.GeometryMultiPoint:
+		slice := geometry.LineString
+		if geometry.Type == geojson.GeometryMultiPoint {
+			slice = geometry.MultiPoint
+		}
+		for i := range slice {
+			coordinates = append(coordinates, coordinate{childPath(path, i), &slice[i]})
+		}
+	case geojson.GeometryPolygon, geojson.GeometryMultiLineString:
+		slice := geometry.Polygon
+		if geometry.Type == geojson.GeometryMultiLineString {
+			slice = geometry.MultiLineString
+		}
 		for i := range slice {
 			for j := range slice[i] {
-				ch <- p{i, j}
+				coordinates = append(coordinates, coordinate{childPath(path, i, j), &slice[i][j]})
 			}
 		}
-		close(ch)
-		wg.Done()
-	}()
-	for i := 0; i < n; i++ {
-		go func() {
-			for p := range ch {
-				point, err := d.AddElevation(slice[p.i][p.j])
-				if err != nil {
-					log.Error().Caller().Err(err).Msg("")
+	case geojson.GeometryMultiPolygon:
+		slice := geometry.MultiPolygon
+		for i := range slice {
+			for j := range slice[i] {
+				for k := range slice[i][j] {
+					coordinates = append(coordinates, coordinate{childPath(path, i, j, k), &slice[i][j][k]})
 				}
-				slice[p.i][p.j] = point
 			}
-			wg.Done()
-		}()
+		}
+	case geojson.GeometryCollection:
+		for i, g := range geometry.Geometries {
+			if g == nil {
+				continue
+			}
+			var err error
+			coordinates, err = collect(g, childPath(path, i), coordinates)
+			if err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported geometry type '%s'", geometry.Type)
 	}
-	wg.Wait()
+	return coordinates, nil
 }
 
-func (d *SRTM) process2(slice [][]float64, n int) {
-	wg := sync.WaitGroup{}
-	wg.Add(n+1)
-	ch := make(chan int, n)
-	go func() {
-		for i := range slice {
-			ch <- i
-		}
-		close(ch)
-		wg.Done()
-	}()
-	for i := 0; i < n; i++ {
-		go func() {
-			for i := range ch {
-				point, err := d.AddElevation(slice[i])
+// process adds elevations to all coordinates on workers pool. Coordinates are
+// processed tile by tile, every tile is pinned in cache while its coordinates are processed
+func (d *SRTM) process(coordinates []coordinate, skipErrors bool, datum Datum) error {
+	fill, withFill := d.fill.Load().(float64)
+	mtx := sync.Mutex{}
+	errs := make(PointErrors, 0)
+	fail := func(c coordinate, err error) {
+		d.log.Debug("add elevation", "path", c.path, "error", err)
+		original := *c.point
+		if withFill && len(original) >= 2 {
+			*c.point = []float64{original[0], original[1], fill}
+		}
+		mtx.Lock()
+		errs = append(errs, &PointError{
+			Path: c.path,
+			Err:  err,
+		})
+		mtx.Unlock()
+	}
+	keys := make([]string, 0)
+	buckets := make(map[string][]coordinate)
+	for _, c := range coordinates {
+		ll, err := pointLatLng(*c.point)
+		if err != nil {
+			fail(c, err)
+			continue
+		}
+		key := tileKey(ll)
+		if _, ok := buckets[key]; !ok {
+			keys = append(keys, key)
+		}
+		buckets[key] = append(buckets[key], c)
+	}
+	for _, key := range keys {
+		bucket := buckets[key]
+		ll, _ := pointLatLng(*bucket[0].point)
+		tile, err := d.pinTile(ll)
+		if err != nil {
+			d.log.Error("loadTile", "latLng", ll.String(), "error", err)
+			for _, c := range bucket {
+				original := *c.point
+				ll, _ := pointLatLng(original)
+				point, err := d.fallbackElevation(append(make([]float64, 0, 3), original...), ll, datum, err)
 				if err != nil {
-					log.Error().Caller().Err(err).Msg("")
+					fail(c, err)
+					continue
 				}
-				slice[i] = point
+				*c.point = point
 			}
-			wg.Done()
-		}()
+			continue
+		}
+		d.pool.run(len(bucket), func(i int) {
+			c := bucket[i]
+			original := *c.point
+			ll, _ := pointLatLng(original)
+			point, err := d.tileElevation(tile, append(make([]float64, 0, 3), original...), ll, datum)
+			if err != nil {
+				fail(c, err)
+				return
+			}
+			*c.point = point
+		})
+		d.unpinTile(ll)
+	}
+	if len(errs) == 0 || skipErrors {
+		return nil
 	}
-	wg.Wait()
+	sort.Slice(errs, func(i, j int) bool {
+		return lessPath(errs[i].Path, errs[j].Path)
+	})
+	return errs
 }
 
+func lessPath(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
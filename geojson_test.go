@@ -1,8 +1,8 @@
 package srtm
 
 import (
+	"errors"
 	geojson "github.com/paulmach/go.geojson"
-	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
 	"math"
 	"math/rand"
@@ -144,7 +144,6 @@ func init() {
 		{-67.0 + rand.Float64(), -46.0 + rand.Float64()},
 	}
 	lineString = geojson.NewLineStringGeometry(coordinates)
-	zerolog.SetGlobalLevel(zerolog.NoLevel)
 }
 
 func TestAddElevations_Point(t *testing.T) {
@@ -186,50 +185,186 @@ func TestAddElevations_LineString(t *testing.T) {
 }
 
 func TestAddElevations_LineString_Rand(t *testing.T) {
-	data, err := New(1, "testdata", -1)
+	data, err := NewWithOptions(
+		WithLRUCacheSize(1),
+		WithTileDirectory("testdata"),
+		WithExpiration(-1),
+		WithDownload(false),
+	)
 	require.NoError(t, err)
 	defer data.Destroy()
-	require.NoError(t, data.AddElevations(lineString, false))
+	// random points are placed in tile S46W067 which is missing in testdata
+	lineString := geojson.NewLineStringGeometry(append([][]float64{}, lineString.LineString...))
+	err = data.AddElevations(lineString, false)
+	var errs PointErrors
+	require.True(t, errors.As(err, &errs))
+	require.Equal(t, len(lineString.LineString), len(errs))
+	for i, e := range errs {
+		require.Equal(t, []int{i}, e.Path)
+		require.ErrorIs(t, e, ErrTileNotFound)
+		require.Equal(t, 2, len(lineString.LineString[i]))
+	}
 }
 
-func Benchmark_process2_1(b *testing.B) {
+func Benchmark_process_1(b *testing.B) {
 	data, err := New(1, "testdata", -1)
 	require.NoError(b, err)
 	defer data.Destroy()
-	data.process2(lineString.LineString, 1)
+	coordinates, err := collect(lineString, nil, nil)
+	require.NoError(b, err)
+	data.SetWorkers(1)
+	data.process(coordinates, true, DatumEGM96)
 }
 
-func Benchmark_process2_4(b *testing.B) {
+func Benchmark_process_4(b *testing.B) {
 	data, err := New(1, "testdata", -1)
 	require.NoError(b, err)
 	defer data.Destroy()
-	data.process2(lineString.LineString, 4)
+	coordinates, err := collect(lineString, nil, nil)
+	require.NoError(b, err)
+	data.SetWorkers(4)
+	data.process(coordinates, true, DatumEGM96)
 }
 
-func Benchmark_process2_8(b *testing.B) {
+func Benchmark_process_8(b *testing.B) {
 	data, err := New(1, "testdata", -1)
 	require.NoError(b, err)
 	defer data.Destroy()
-	data.process2(lineString.LineString, 8)
+	coordinates, err := collect(lineString, nil, nil)
+	require.NoError(b, err)
+	data.SetWorkers(8)
+	data.process(coordinates, true, DatumEGM96)
 }
 
-func Benchmark_process2_16(b *testing.B) {
+func Benchmark_process_16(b *testing.B) {
 	data, err := New(1, "testdata", -1)
 	require.NoError(b, err)
 	defer data.Destroy()
-	data.process2(lineString.LineString, 16)
+	coordinates, err := collect(lineString, nil, nil)
+	require.NoError(b, err)
+	data.SetWorkers(16)
+	data.process(coordinates, true, DatumEGM96)
 }
 
-func Benchmark_process2_32(b *testing.B) {
+func Benchmark_process_32(b *testing.B) {
 	data, err := New(1, "testdata", -1)
 	require.NoError(b, err)
 	defer data.Destroy()
-	data.process2(lineString.LineString, 32)
+	coordinates, err := collect(lineString, nil, nil)
+	require.NoError(b, err)
+	data.SetWorkers(32)
+	data.process(coordinates, true, DatumEGM96)
 }
 
-func Benchmark_process2_NCPU(b *testing.B) {
+func Benchmark_process_NCPU(b *testing.B) {
 	data, err := New(1, "testdata", -1)
 	require.NoError(b, err)
 	defer data.Destroy()
-	data.process2(lineString.LineString, runtime.NumCPU())
-}
\ No newline at end of file
+	coordinates, err := collect(lineString, nil, nil)
+	require.NoError(b, err)
+	data.SetWorkers(runtime.NumCPU())
+	data.process(coordinates, true, DatumEGM96)
+}
+
+func TestAddElevations_MultiPolygon(t *testing.T) {
+	data, err := New(1, "testdata", -1)
+	require.NoError(t, err)
+	defer data.Destroy()
+	multiPolygon, err := geojson.UnmarshalGeometry([]byte(`{"type":"MultiPolygon","coordinates":[[[[-65.9,-45.1],[-65.8,-45.1],[-65.8,-45.2],[-65.9,-45.1]]],[[[-65.5,-45.5],[-65.4,-45.5],[-65.4,-45.6],[-65.5,-45.5]]]]}`))
+	require.NoError(t, err)
+	require.NoError(t, data.AddElevations(multiPolygon, false))
+	for _, polygon := range multiPolygon.MultiPolygon {
+		for _, ring := range polygon {
+			for _, point := range ring {
+				require.Equal(t, 3, len(point))
+			}
+		}
+	}
+}
+
+func TestAddElevations_GeometryCollection(t *testing.T) {
+	data, err := New(1, "testdata", -1)
+	require.NoError(t, err)
+	defer data.Destroy()
+	collection, err := geojson.UnmarshalGeometry([]byte(`{"type":"GeometryCollection","geometries":[{"type":"Point","coordinates":[-65.92054637662613,-45.02475838113942]},{"type":"GeometryCollection","geometries":[{"type":"LineString","coordinates":[[-65.9,-45.1],[-65.8,-45.1]]}]}]}`))
+	require.NoError(t, err)
+	require.NoError(t, data.AddElevations(collection, false))
+	require.Equal(t, 25, int(math.Round(collection.Geometries[0].Point[2])))
+	for _, point := range collection.Geometries[1].Geometries[0].LineString {
+		require.Equal(t, 3, len(point))
+	}
+}
+
+func TestAddElevations_UnsupportedType(t *testing.T) {
+	data, err := New(1, "testdata", -1)
+	require.NoError(t, err)
+	defer data.Destroy()
+	require.Error(t, data.AddElevations(&geojson.Geometry{Type: "Circle"}, false))
+}
+
+func TestAddElevationsJSON(t *testing.T) {
+	data, err := New(1, "testdata", -1)
+	require.NoError(t, err)
+	defer data.Destroy()
+	b, err := data.AddElevationsJSON([]byte(`{"type":"Feature","id":"p1","properties":{"name":"parcel"},"geometry":{"type":"Point","coordinates":[-65.92054637662613,-45.02475838113942]}}`), false, DatumEGM96)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"type":"Feature","id":"p1","properties":{"name":"parcel"},"geometry":{"type":"Point","coordinates":[-65.92054637662613,-45.02475838113942,24.874129324015318]}}`, string(b))
+	b, err = data.AddElevationsJSON([]byte(`{"type":"FeatureCollection","features":[{"type":"Feature","properties":{"n":1},"geometry":{"type":"Point","coordinates":[-65.92054637662613,-45.02475838113942]}},{"type":"Feature","properties":{"n":2},"geometry":null}]}`), false, DatumEGM96)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{"n":1},"geometry":{"type":"Point","coordinates":[-65.92054637662613,-45.02475838113942,24.874129324015318]}},{"type":"Feature","properties":{"n":2},"geometry":null}]}`, string(b))
+}
+
+func TestAddElevations_PointErrors(t *testing.T) {
+	data, err := New(1, "testdata", -1)
+	require.NoError(t, err)
+	defer data.Destroy()
+	data.bads = []string{"N10E010"}
+	multiLineString, err := geojson.UnmarshalGeometry([]byte(`{"type":"MultiLineString","coordinates":[[[-65.9,-45.1],[10.5,10.5]],[[-65.8,-45.2],[10.1,10.1]]]}`))
+	require.NoError(t, err)
+	err = data.AddElevations(multiLineString, false)
+	require.Error(t, err)
+	var errs PointErrors
+	require.True(t, errors.As(err, &errs))
+	require.Equal(t, 2, len(errs))
+	require.Equal(t, []int{0, 1}, errs[0].Path)
+	require.Equal(t, []int{1, 1}, errs[1].Path)
+	require.Equal(t, []float64{10.5, 10.5}, multiLineString.MultiLineString[0][1])
+	require.Equal(t, 3, len(multiLineString.MultiLineString[0][0]))
+	b, err := multiLineString.MarshalJSON()
+	require.NoError(t, err)
+	_, err = geojson.UnmarshalGeometry(b)
+	require.NoError(t, err)
+}
+
+func TestAddElevations_SkipErrorsWithFill(t *testing.T) {
+	data, err := New(1, "testdata", -1)
+	require.NoError(t, err)
+	defer data.Destroy()
+	data.bads = []string{"N10E010"}
+	data.SetFillValue(0)
+	multiPoint := geojson.NewMultiPointGeometry([]float64{10.5, 10.5}, []float64{-65.9, -45.1})
+	require.NoError(t, data.AddElevations(multiPoint, true))
+	require.Equal(t, []float64{10.5, 10.5, 0}, multiPoint.MultiPoint[0])
+	require.Equal(t, 3, len(multiPoint.MultiPoint[1]))
+	point := geojson.NewPointGeometry([]float64{10.5, 10.5})
+	require.NoError(t, data.AddElevations(point, true))
+	require.Equal(t, []float64{10.5, 10.5, 0}, point.Point)
+}
+
+func TestAddElevationsFeatureCollection_PointErrors(t *testing.T) {
+	data, err := New(1, "testdata", -1)
+	require.NoError(t, err)
+	defer data.Destroy()
+	data.bads = []string{"N10E010"}
+	featureCollection := geojson.NewFeatureCollection()
+	featureCollection.AddFeature(geojson.NewPointFeature([]float64{-65.9, -45.1}))
+	featureCollection.AddFeature(geojson.NewCollectionFeature(
+		geojson.NewPointGeometry([]float64{-65.9, -45.1}),
+		geojson.NewLineStringGeometry([][]float64{{-65.9, -45.1}, {10.5, 10.5}}),
+	))
+	err = data.AddElevationsFeatureCollection(featureCollection, false)
+	var errs PointErrors
+	require.True(t, errors.As(err, &errs))
+	require.Equal(t, 1, len(errs))
+	require.Equal(t, []int{1, 1, 1}, errs[0].Path)
+}
@@ -1,40 +1,87 @@
 package srtm
 
 import (
-	"archive/zip"
-	"bytes"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"github.com/rs/zerolog/log"
 	"io"
-	"io/ioutil"
-	"math/rand"
 	"net/http"
-	"os"
-	"path"
-	"path/filepath"
-	"runtime"
-	"strconv"
-	"strings"
-	"time"
+	"sync"
 )
 
+// imagicoSearchURL is a format of request to imagico service with lon, lat, lonE, latE
+const imagicoSearchURL = "http://www.imagico.de/map/dem_json.php?date=&lon=%0.7f&lat=%0.7f&lonE=%0.7f&latE=%0.7f&vf=1"
+
+// client returns default http client of downloads. It verifies TLS certificates
+// and uses proxy from HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
 func client() *http.Client {
 	return &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-		},
-		Timeout: time.Second * 10,
+		Transport: http.DefaultTransport.(*http.Transport).Clone(),
+		Timeout:   defaultDownloadTimeout,
+	}
+}
+
+// imagicoProvider searches zipped tiles of viewfinderpanoramas and others with imagico service
+type imagicoProvider struct {
+	searchURL string
+}
+
+// ImagicoProvider returns provider of zipped tiles found with imagico service
+// (default provider of SRTM)
+func ImagicoProvider() Provider {
+	return &imagicoProvider{
+		searchURL: imagicoSearchURL,
+	}
+}
+
+func (p *imagicoProvider) Name() string {
+	return "imagico"
+}
+
+// search returns urls of zipped tiles contains location
+func (p *imagicoProvider) search(d *downloader, ll LatLng) ([]string, error) {
+	r, err := d.get(d.client, fmt.Sprintf(p.searchURL, ll.Longitude, ll.Latitude, ll.Longitude, ll.Latitude))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	return parse(r.Body)
+}
+
+func (p *imagicoProvider) download(d *downloader, tileDir string, ll LatLng) ([]string, error) {
+	urls, err := p.search(d, ll)
+	if err != nil {
+		return nil, err
 	}
+	var (
+		wg        sync.WaitGroup
+		mtx       sync.Mutex
+		errs      = make([]string, 0)
+		extracted = make([]string, 0)
+	)
+	for _, url := range urls {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			files, err := d.fetchZip(d.client, tileDir, url)
+			mtx.Lock()
+			defer mtx.Unlock()
+			extracted = append(extracted, files...)
+			if err != nil {
+				d.log.Error("download", "url", url, "error", err)
+				errs = append(errs, err.Error())
+			}
+		}(url)
+	}
+	wg.Wait()
+	if len(errs) == len(urls) {
+		return extracted, fmt.Errorf("download of urls %+v failed (%+v)", urls, errs)
+	}
+	return extracted, nil
 }
 
 func parse(r io.Reader) ([]string, error) {
 	var v []interface{}
 	if err := json.NewDecoder(r).Decode(&v); err != nil {
-		log.Error().Caller().Err(err).Msg("decode json")
 		return nil, err
 	}
 	if len(v) == 0 {
@@ -58,127 +105,3 @@ func parse(r io.Reader) ([]string, error) {
 	}
 	return urls, nil
 }
-
-func search(ll LatLng) ([]string, error) {
-	r, err := client().Get(fmt.Sprintf("http://www.imagico.de/map/dem_json.php?date=&lon=%0.7f&lat=%0.7f&lonE=%0.7f&latE=%0.7f&vf=1", ll.Longitude, ll.Latitude, ll.Longitude, ll.Latitude))
-	if err != nil {
-		log.Error().Caller().Err(err).Msg("GET")
-		return nil, err
-	}
-	if r.StatusCode != http.StatusOK {
-		err = fmt.Errorf("status code for request '%s' is not Ok (%d)", r.Request.RequestURI, r.StatusCode)
-		log.Error().Caller().Err(err).Msg("GET")
-		return nil, err
-	}
-	defer r.Body.Close()
-	return parse(r.Body)
-}
-
-func moveHgt(sourcePath, destPath string) error {
-	inputFile, err := os.Open(sourcePath)
-	if err != nil {
-		return fmt.Errorf("Couldn't open source file: %s", err)
-	}
-	outputFile, err := os.Create(destPath)
-	if err != nil {
-		inputFile.Close()
-		return fmt.Errorf("Couldn't open dest file: %s", err)
-	}
-	defer outputFile.Close()
-	_, err = io.Copy(outputFile, inputFile)
-	inputFile.Close()
-	if err != nil {
-		return fmt.Errorf("Writing to output file failed: %s", err)
-	}
-	err = os.Remove(sourcePath)
-	if err != nil {
-		return fmt.Errorf("Failed removing original file: %s", err)
-	}
-	return nil
-}
-
-func downloadByURL(tileDir, url string) (extracted []string) {
-	defer runtime.GC()
-	targetDir := path.Join(os.TempDir(), "srtm-" + strconv.Itoa(rand.Int()))
-	err := os.Mkdir(targetDir, 0755)
-	if err != nil {
-		log.Error().Caller().Err(err).Msg("")
-		return extracted
-	}
-	defer os.RemoveAll(targetDir)
-	response, err := http.Get(url)
-	if err != nil {
-		log.Error().Caller().Err(err).Msg("")
-		return extracted
-	}
-	defer response.Body.Close()
-	b, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		log.Error().Caller().Err(err).Msg("")
-		return extracted
-	}
-	zipReader, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
-	if err != nil {
-		log.Error().Caller().Err(err).Msg("")
-		return extracted
-	}
-	for _, file := range zipReader.File {
-		zippedFile, err := file.Open()
-		if err != nil {
-			log.Error().Caller().Err(err).Msg("unzip")
-		}
-		extractedFilePath := filepath.Join(
-			targetDir,
-			file.Name,
-		)
-		if file.FileInfo().IsDir() {
-			os.MkdirAll(extractedFilePath, file.Mode())
-		} else {
-			outputFile, err := os.OpenFile(
-				extractedFilePath,
-				os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
-				file.Mode(),
-			)
-			if err != nil {
-				log.Error().Caller().Err(err).Msg("open file")
-			}
-			_, err = io.Copy(outputFile, zippedFile)
-			if err != nil {
-				log.Error().Caller().Err(err).Msg("copy")
-			}
-			outputFile.Close()
-			if err == nil {
-				_, file := path.Split(extractedFilePath)
-				hgt := path.Join(tileDir, file)
-				extracted = append(extracted, hgt)
-				if err := moveHgt(extractedFilePath, hgt); err != nil {
-					log.Error().Caller().Err(err).Msg("move")
-				}
-			}
-		}
-		zippedFile.Close()
-	}
-	return extracted
-}
-
-func download(tileDir string, ll LatLng) (string, os.FileInfo, error) {
-	key := tileKey(ll)
-	urls, err := search(ll)
-	if err != nil {
-		return "", nil, err
-	}
-	extracted := make([]string, 0)
-	for _, url := range urls {
-		extracted = append(extracted, downloadByURL(tileDir, url)...)
-	}
-	for _, hgt := range extracted {
-		if strings.Contains(hgt, key) {
-			info, err := os.Stat(hgt)
-			if err != nil {
-				return "", nil, nil
-			}
-			return hgt, info, nil
-		}
-	}
-	return "", nil, fmt.Errorf("tile file for key = %s is not exists (urls %+v -> %+v)", key, urls, extracted)
-}
@@ -0,0 +1,203 @@
+package srtm
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// TileInfo contains information about tile file in tile directory
+type TileInfo struct {
+	Key    string     `json:"key"`
+	Path   string     `json:"path"`
+	Format TileFormat `json:"format"`
+	// Resolution of tile in arcseconds (1 or 3)
+	Resolution int `json:"resolution,omitempty"`
+	// Bytes is a size of tile file on disk
+	Bytes int64 `json:"bytes"`
+	// Source is a name of provider of downloaded tile
+	Source string `json:"source,omitempty"`
+	// Error is not empty for invalid tile file
+	Error string `json:"error,omitempty"`
+}
+
+// Coverage contains state of tiles inside bbox
+type Coverage struct {
+	BBox BBox `json:"bbox"`
+	// Tiles are valid tile files (one file per key)
+	Tiles []TileInfo `json:"tiles"`
+	// Missing are keys of tiles without files
+	Missing []string `json:"missing"`
+	// Bads are keys of invalid tile files and tiles marked as bad
+	Bads []string `json:"bads"`
+}
+
+// gzipSize returns uncompressed size of gzip file from ISIZE trailer
+// (size modulo 2^32, which is enough for SRTM tiles)
+func gzipSize(path string, size int64) (int64, error) {
+	if size < 18 {
+		return 0, errors.Errorf("gzip file %s is too short", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	trailer := make([]byte, 4)
+	if _, err := f.ReadAt(trailer, size-4); err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint32(trailer)), nil
+}
+
+// zstdSize returns uncompressed size of zstd file from frame header or
+// by decompression of file if size is not written into header
+func zstdSize(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	header := make([]byte, zstd.HeaderMaxSize)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	var h zstd.Header
+	if err := h.Decode(header[:n]); err != nil {
+		return 0, errors.Wrapf(err, "zstd file %s", path)
+	}
+	if h.HasFCS {
+		return int64(h.FrameContentSize), nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r, err := decompress(FormatHGTZstd, f)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	return io.Copy(ioutil.Discard, r)
+}
+
+// tileInfo returns information about tile file
+func tileInfo(path string, info os.FileInfo) TileInfo {
+	t := TileInfo{
+		Key:    strings.SplitN(info.Name(), ".", 2)[0],
+		Path:   path,
+		Format: tileFormat(path),
+		Bytes:  info.Size(),
+	}
+	size := info.Size()
+	var err error
+	switch t.Format {
+	case FormatHGTGzip:
+		size, err = gzipSize(path, info.Size())
+	case FormatHGTZstd:
+		size, err = zstdSize(path)
+	case FormatHGTBlock:
+		size, err = blockSize(path)
+	}
+	if err != nil {
+		t.Error = err.Error()
+		return t
+	}
+	_, squareSize, err := Meta(path, size)
+	if err != nil {
+		t.Error = err.Error()
+		return t
+	}
+	t.Resolution = 3600 / (squareSize - 1)
+	return t
+}
+
+// Inventory scans tile directory and returns information about all tile files
+// sorted by key and format priority
+func (d *SRTM) Inventory() ([]TileInfo, error) {
+	infos, err := ioutil.ReadDir(d.tileDirectory)
+	if err != nil {
+		return nil, err
+	}
+	tiles := make([]TileInfo, 0, len(infos))
+	for _, info := range infos {
+		if info.IsDir() || srtmParseName.FindString(info.Name()) != info.Name() {
+			continue
+		}
+		t := tileInfo(filepath.Join(d.tileDirectory, info.Name()), info)
+		if e, ok := d.manifest.get(info.Name()); ok {
+			t.Source = e.Source
+		}
+		tiles = append(tiles, t)
+	}
+	sort.SliceStable(tiles, func(i, j int) bool {
+		if tiles[i].Key != tiles[j].Key {
+			return tiles[i].Key < tiles[j].Key
+		}
+		// tiles of key are ordered as they are found by findKey
+		return suffixPriority(tiles[i].Path) < suffixPriority(tiles[j].Path)
+	})
+	return tiles, nil
+}
+
+// suffixPriority returns index of suffix of tile file path in suffixes
+func suffixPriority(tilePath string) int {
+	name := filepath.Base(tilePath)
+	for i, s := range suffixes {
+		if len(name) == 7+len(s) && strings.HasSuffix(name, s) {
+			return i
+		}
+	}
+	return len(suffixes)
+}
+
+// Coverage returns present, missing and bad tiles inside bbox
+func (d *SRTM) Coverage(bbox BBox) (*Coverage, error) {
+	inventory, err := d.Inventory()
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]TileInfo, len(inventory))
+	for _, t := range inventory {
+		if _, ok := files[t.Key]; !ok {
+			files[t.Key] = t
+		}
+	}
+	bads := make(map[string]bool)
+	if view, ok := d.badsView.Load().([]string); ok {
+		for _, key := range view {
+			bads[key] = true
+		}
+	}
+	coverage := &Coverage{
+		BBox:    bbox,
+		Tiles:   make([]TileInfo, 0),
+		Missing: make([]string, 0),
+		Bads:    make([]string, 0),
+	}
+	seen := make(map[string]bool)
+	for _, ll := range bbox.tiles() {
+		key := tileKey(ll)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		t, ok := files[key]
+		switch {
+		case !ok:
+			coverage.Missing = append(coverage.Missing, key)
+		case len(t.Error) > 0 || bads[key]:
+			coverage.Bads = append(coverage.Bads, key)
+		default:
+			coverage.Tiles = append(coverage.Tiles, t)
+		}
+	}
+	return coverage, nil
+}
@@ -0,0 +1,90 @@
+package srtm
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInventory(t *testing.T) {
+	data, err := NewWithOptions(
+		WithTileDirectory("testdata"),
+		WithExpiration(-1),
+		WithDownload(false),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	tiles, err := data.Inventory()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(tiles))
+	require.Equal(t, "S46W066", tiles[0].Key)
+	require.Equal(t, FormatHGTGzip, tiles[0].Format)
+	require.Equal(t, 1, tiles[0].Resolution)
+	require.Empty(t, tiles[0].Error)
+	info, err := os.Stat(path.Join("testdata", "S46W066.hgt.gz"))
+	require.NoError(t, err)
+	require.Equal(t, info.Size(), tiles[0].Bytes)
+}
+
+func TestInventory_Priority(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"N10E010.hgt.blk", "N10E010.hgt.zst", "N10E010.hgt.gz", "N10E010.hgt"} {
+		require.NoError(t, ioutil.WriteFile(path.Join(dir, name), []byte{1, 2, 3}, 0644))
+	}
+	data, err := NewWithOptions(
+		WithTileDirectory(dir),
+		WithExpiration(-1),
+		WithDownload(false),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	tiles, err := data.Inventory()
+	require.NoError(t, err)
+	formats := make([]TileFormat, 0, len(tiles))
+	for _, tile := range tiles {
+		formats = append(formats, tile.Format)
+	}
+	require.Equal(t, []TileFormat{FormatHGT, FormatHGTGzip, FormatHGTZstd, FormatHGTBlock}, formats)
+	tPath, _, err := findKey(dir, "N10E010")
+	require.NoError(t, err)
+	require.Equal(t, tPath, tiles[0].Path)
+}
+
+func TestCoverage(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTile(t, dir, "N10E010", 100)
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "N10E011.hgt"), []byte{1, 2, 3}, 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "README"), []byte{1, 2, 3}, 0644))
+	data, err := NewWithOptions(
+		WithTileDirectory(dir),
+		WithExpiration(-1),
+		WithDownload(false),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	bbox, err := ParseBBox("10.5,10.5,11.5,11.5")
+	require.NoError(t, err)
+	coverage, err := data.Coverage(bbox)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(coverage.Tiles))
+	require.Equal(t, "N10E010", coverage.Tiles[0].Key)
+	require.Equal(t, FormatHGT, coverage.Tiles[0].Format)
+	require.Equal(t, 3, coverage.Tiles[0].Resolution)
+	require.Equal(t, []string{"N10E011"}, coverage.Bads)
+	require.Equal(t, []string{"N11E010", "N11E011"}, coverage.Missing)
+}
+
+func TestParseKey(t *testing.T) {
+	for _, key := range []string{"N10E010", "S46W066", "N89W180"} {
+		sw, err := ParseKey(key)
+		require.NoError(t, err)
+		require.Equal(t, key, tileKey(sw))
+	}
+	for _, key := range []string{"", "N10E010.hgt", "X10E010"} {
+		_, err := ParseKey(key)
+		require.ErrorIs(t, err, ErrInvalidHGTFileName)
+	}
+}
@@ -0,0 +1,212 @@
+package srtm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// lockStale is an age of lock file after which lock is considered to be
+	// left by crashed process. Owner of lock refreshes it more frequently
+	lockStale = time.Minute
+	// lockPoll is an interval of lock file checks while it is held by others
+	lockPoll = 100 * time.Millisecond
+	// lockTimeout is a max time of wait for lock of tile (download or compaction)
+	lockTimeout = 10 * time.Minute
+	// manifestLockTimeout is a max time of wait for lock of manifest
+	manifestLockTimeout = lockStale
+	// tempStale is an age of temporary file after which it is considered to be
+	// left by crashed process
+	tempStale = time.Hour
+)
+
+// ErrLockTimeout is returned when lock file is held by other owner longer than timeout
+var ErrLockTimeout = errors.New("lock timeout")
+
+// tempPrefixes are prefixes of names of temporary files in tile directory
+var tempPrefixes = []string{".download-", ".extract-", ".compact-", ".manifest-", ".write-"}
+
+// lockFile is an advisory lock shared between processes (for example replicas
+// of srtm-service with one tile directory on shared volume). Lock is acquired
+// by exclusive creation of file with unique owner token and released by removal
+// of it by owner only
+type lockFile struct {
+	path  string
+	token string
+	done  chan struct{}
+}
+
+// lockSeq makes owner tokens of locks unique inside process
+var lockSeq uint64
+
+// lockToken returns unique token of lock owner (host, pid and sequence)
+func lockToken() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s %d %d %d\n", host, os.Getpid(), time.Now().UnixNano(), atomic.AddUint64(&lockSeq, 1))
+}
+
+// lock acquires lock file at path. lock waits while lock file is held by others
+// (but not longer than timeout) and takes over lock files which were not refreshed
+// during lockStale
+func lock(path string, timeout time.Duration) (*lockFile, error) {
+	token := lockToken()
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = f.WriteString(token)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			l := &lockFile{
+				path:  path,
+				token: token,
+				done:  make(chan struct{}),
+			}
+			go l.refresh()
+			return l, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockStale {
+			breakStale(path, token)
+			continue
+		}
+		if time.Now().After(deadline) {
+			owner, _ := ioutil.ReadFile(path)
+			return nil, errors.Wrapf(ErrLockTimeout, "%s is held by %s during %s", path, strings.TrimSpace(string(owner)), timeout)
+		}
+		time.Sleep(lockPoll)
+	}
+}
+
+// breakStale removes stale lock file. Lock file is renamed to unique name first,
+// so only one of waiters takes over it. Lock file which was replaced or refreshed
+// by other process after check of staleness is restored
+func breakStale(path, token string) {
+	owner, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	stale := fmt.Sprintf("%s.%x", path, sha256.Sum256([]byte(token)))
+	if err := os.Rename(path, stale); err != nil {
+		return
+	}
+	defer os.Remove(stale)
+	b, err := ioutil.ReadFile(stale)
+	info, serr := os.Stat(stale)
+	if err == nil && serr == nil && bytes.Equal(b, owner) && time.Since(info.ModTime()) > lockStale {
+		return
+	}
+	os.Link(stale, path)
+}
+
+// owned checks that lock file at path is still held by l
+func (l *lockFile) owned() bool {
+	b, err := ioutil.ReadFile(l.path)
+	return err == nil && string(b) == l.token
+}
+
+// refresh touches lock file until unlock, so long downloads are not treated as stale
+func (l *lockFile) refresh() {
+	ticker := time.NewTicker(lockStale / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case now := <-ticker.C:
+			if l.owned() {
+				os.Chtimes(l.path, now, now)
+			}
+		}
+	}
+}
+
+// unlock releases lock file. Lock file of other owner (which took over lock
+// treated as stale) is not removed
+func (l *lockFile) unlock() error {
+	close(l.done)
+	if !l.owned() {
+		return fmt.Errorf("lock file %s is not owned", l.path)
+	}
+	return os.Remove(l.path)
+}
+
+// removeStaleTemp removes temporary files and renamed stale lock files left in dir
+// by crashed processes. Files of running processes are fresh, so they are kept.
+// removeStaleTemp returns paths of removed files
+func removeStaleTemp(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	removed := make([]string, 0)
+	for _, info := range infos {
+		if info.IsDir() || time.Since(info.ModTime()) < tempStale || !isTemp(info.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, info.Name())
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+// isTemp checks name of temporary file or renamed stale lock file (see breakStale)
+func isTemp(name string) bool {
+	for _, prefix := range tempPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return strings.HasPrefix(name, ".") && strings.Contains(name, ".lock.")
+}
+
+// install makes tmp file visible at dest atomically: content is flushed to disk
+// before rename, so readers of dest never see partially written file.
+// tmp must be created in directory of dest. tmp is closed by install
+func install(tmp *os.File, dest string) error {
+	err := tmp.Chmod(0644)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(dest))
+	return nil
+}
+
+// syncDir flushes directory entries after rename. Errors are ignored because
+// directories can't be synced on some platforms (windows)
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
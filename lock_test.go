@@ -0,0 +1,159 @@
+package srtm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".test.lock")
+	l, err := lock(path, lockTimeout)
+	require.NoError(t, err)
+	var acquired int32
+	errs := make(chan error, 1)
+	go func() {
+		l, err := lock(path, lockTimeout)
+		if err == nil {
+			atomic.StoreInt32(&acquired, 1)
+			err = l.unlock()
+		}
+		errs <- err
+	}()
+	time.Sleep(3 * lockPoll)
+	require.Equal(t, int32(0), atomic.LoadInt32(&acquired))
+	require.NoError(t, l.unlock())
+	require.NoError(t, <-errs)
+	require.Equal(t, int32(1), atomic.LoadInt32(&acquired))
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestLock_Stale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".test.lock")
+	require.NoError(t, ioutil.WriteFile(path, nil, 0644))
+	stale := time.Now().Add(-2 * lockStale)
+	require.NoError(t, os.Chtimes(path, stale, stale))
+	l, err := lock(path, lockTimeout)
+	require.NoError(t, err)
+	require.NoError(t, l.unlock())
+}
+
+func TestLock_Stale_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".test.lock")
+	require.NoError(t, ioutil.WriteFile(path, []byte("crashed 1\n"), 0644))
+	stale := time.Now().Add(-2 * lockStale)
+	require.NoError(t, os.Chtimes(path, stale, stale))
+	var holders, max int32
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			l, err := lock(path, lockTimeout)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if n := atomic.AddInt32(&holders, 1); n > atomic.LoadInt32(&max) {
+				atomic.StoreInt32(&max, n)
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&holders, -1)
+			errs <- l.unlock()
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		require.NoError(t, <-errs)
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&max))
+	infos, err := ioutil.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Empty(t, infos)
+}
+
+func TestLock_Timeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".test.lock")
+	l, err := lock(path, lockTimeout)
+	require.NoError(t, err)
+	defer l.unlock()
+	_, err = lock(path, 3*lockPoll)
+	require.ErrorIs(t, err, ErrLockTimeout)
+}
+
+func TestRemoveStaleTemp(t *testing.T) {
+	dir := t.TempDir()
+	stale := time.Now().Add(-2 * tempStale)
+	for _, name := range []string{".download-1", ".extract-2", ".compact-3", ".manifest-4", ".write-5", ".N10E010.lock.ab12", "N10E010.hgt", ".manifest.json"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, nil, 0644))
+		require.NoError(t, os.Chtimes(path, stale, stale))
+	}
+	// temporary file of running process
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".download-6"), nil, 0644))
+	removed, err := removeStaleTemp(dir)
+	require.NoError(t, err)
+	require.Equal(t, 6, len(removed))
+	infos, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	require.Equal(t, []string{".download-6", ".manifest.json", "N10E010.hgt"}, names)
+}
+
+func TestLock_TakenOver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".test.lock")
+	l, err := lock(path, lockTimeout)
+	require.NoError(t, err)
+	// owner of lock is hung and lock is taken over as stale
+	stale := time.Now().Add(-2 * lockStale)
+	require.NoError(t, os.Chtimes(path, stale, stale))
+	other, err := lock(path, lockTimeout)
+	require.NoError(t, err)
+	require.Error(t, l.unlock())
+	_, err = os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, other.unlock())
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestInstall(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "N10E010.hgt")
+	tmp, err := ioutil.TempFile(dir, ".test-*")
+	require.NoError(t, err)
+	_, err = tmp.Write([]byte{1, 2})
+	require.NoError(t, err)
+	require.NoError(t, install(tmp, dest))
+	b, err := ioutil.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2}, b)
+	_, err = os.Stat(tmp.Name())
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestDownloader_DownloadedByOtherProcess(t *testing.T) {
+	var requests int32
+	dir := t.TempDir()
+	server := testViewfinder(t, &requests)
+	l, err := lock(filepath.Join(dir, ".N10E010.lock"), lockTimeout)
+	require.NoError(t, err)
+	data := testSRTM(t, dir, server)
+	errs := make(chan error, 1)
+	go func() {
+		_, err := data.AddElevation([]float64{10.5, 10.5})
+		errs <- err
+	}()
+	time.Sleep(3 * lockPoll)
+	// other process installs tile and releases lock
+	writeTestTile(t, dir, "N10E010", 100)
+	require.NoError(t, l.unlock())
+	require.NoError(t, <-errs)
+	require.Equal(t, int32(0), atomic.LoadInt32(&requests))
+}
@@ -2,7 +2,70 @@ package srtm
 
 import "github.com/rs/zerolog"
 
-func init() {
-	zerolog.TimeFieldFormat = "2006.01.02-15:04:05.000"
-	zerolog.SetGlobalLevel(zerolog.DebugLevel)
+// Logger is a leveled structured logger of SRTM. Args are alternating keys and values
+// (same as log/slog), so *slog.Logger implements Logger without adapter
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// NopLogger returns logger which discards all messages. It is default logger of SRTM
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+type zerologLogger struct {
+	l zerolog.Logger
+}
+
+// NewZerologLogger returns adapter of zerolog logger
+func NewZerologLogger(l zerolog.Logger) Logger {
+	return &zerologLogger{
+		l: l,
+	}
+}
+
+func (z *zerologLogger) log(e *zerolog.Event, msg string, args []interface{}) {
+	if e == nil {
+		return
+	}
+	fields := make(map[string]interface{}, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok {
+			key = "!BADKEY"
+		}
+		if i+1 < len(args) {
+			fields[key] = args[i+1]
+		} else {
+			fields[key] = nil
+		}
+	}
+	// skip frames of adapter
+	e.Caller(2).Fields(fields).Msg(msg)
+}
+
+func (z *zerologLogger) Debug(msg string, args ...interface{}) {
+	z.log(z.l.Debug(), msg, args)
+}
+
+func (z *zerologLogger) Info(msg string, args ...interface{}) {
+	z.log(z.l.Info(), msg, args)
+}
+
+func (z *zerologLogger) Warn(msg string, args ...interface{}) {
+	z.log(z.l.Warn(), msg, args)
+}
+
+func (z *zerologLogger) Error(msg string, args ...interface{}) {
+	z.log(z.l.Error(), msg, args)
 }
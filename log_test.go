@@ -0,0 +1,70 @@
+package srtm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+type recordLogger struct {
+	records []string
+}
+
+func (r *recordLogger) record(level, msg string, args []interface{}) {
+	r.records = append(r.records, fmt.Sprint(append([]interface{}{level, msg}, args...)...))
+}
+
+func (r *recordLogger) Debug(msg string, args ...interface{}) { r.record("debug", msg, args) }
+func (r *recordLogger) Info(msg string, args ...interface{})  { r.record("info", msg, args) }
+func (r *recordLogger) Warn(msg string, args ...interface{})  { r.record("warn", msg, args) }
+func (r *recordLogger) Error(msg string, args ...interface{}) { r.record("error", msg, args) }
+
+func TestZerologLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewZerologLogger(zerolog.New(buf).Level(zerolog.InfoLevel))
+	l.Debug("skipped", "key", 1)
+	require.Equal(t, 0, buf.Len())
+	l.Warn("message", "key", "value", "n", 2, "odd")
+	var v map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &v))
+	require.Equal(t, "warn", v["level"])
+	require.Equal(t, "message", v["message"])
+	require.Equal(t, "value", v["key"])
+	require.Equal(t, float64(2), v["n"])
+	require.Contains(t, v, "odd")
+	require.Contains(t, v["caller"], "log_test.go")
+}
+
+func TestWithLogger(t *testing.T) {
+	l := &recordLogger{}
+	data, err := NewWithOptions(
+		WithTileDirectory("testdata"),
+		WithDownload(false),
+		WithExpiration(-1),
+		WithLogger(l),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	_, err = data.AddElevation([]float64{10.5, 10.5})
+	require.Error(t, err)
+	require.NotEmpty(t, l.records)
+	require.Contains(t, l.records[0], "new srtm")
+	require.Contains(t, l.records[len(l.records)-1], "loadTile")
+}
+
+func TestWithLogger_Nil(t *testing.T) {
+	data, err := NewWithOptions(
+		WithTileDirectory("testdata"),
+		WithDownload(false),
+		WithExpiration(-1),
+		WithLogger(nil),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	_, err = data.AddElevation([]float64{10.5, 10.5})
+	require.Error(t, err)
+}
@@ -0,0 +1,401 @@
+package srtm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCorruptTile is returned when tile file does not match checksum of manifest
+// or can not be decoded
+var ErrCorruptTile = errors.New("corrupt tile")
+
+const (
+	// manifestName is a name of manifest file in tile directory
+	manifestName = ".manifest.json"
+	// quarantineName is a name of directory in tile directory for corrupt tiles
+	quarantineName = ".quarantine"
+)
+
+// ManifestEntry is a checksum record of downloaded tile file
+type ManifestEntry struct {
+	Size   int64     `json:"size"`
+	SHA256 string    `json:"sha256"`
+	Source string    `json:"source"`
+	Time   time.Time `json:"time"`
+	// Access is a time of last access of tile
+	Access time.Time `json:"access"`
+}
+
+// lastAccess returns time of last access or download of tile
+func (e ManifestEntry) lastAccess() time.Time {
+	if e.Access.After(e.Time) {
+		return e.Access
+	}
+	return e.Time
+}
+
+// manifest contains checksums of downloaded tile files by file name
+type manifest struct {
+	mtx     sync.Mutex
+	path    string
+	entries map[string]ManifestEntry
+	// dirty is true when access times are not saved
+	dirty bool
+	// verified contains checksums of tile files verified since start
+	verified map[string]verifiedFile
+}
+
+// verifiedFile is a checksum of tile file with size and modification time at
+// moment of verification
+type verifiedFile struct {
+	size    int64
+	modTime time.Time
+	sha256  string
+}
+
+// loadManifest reads manifest of tile directory. Missing manifest is empty
+func loadManifest(tileDir string) (*manifest, error) {
+	m := &manifest{
+		path:     filepath.Join(tileDir, manifestName),
+		entries:  make(map[string]ManifestEntry),
+		verified: make(map[string]verifiedFile),
+	}
+	b, err := ioutil.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(b, &m.entries); err != nil {
+		m.entries = make(map[string]ManifestEntry)
+		return m, errors.Wrapf(err, "manifest %s", m.path)
+	}
+	return m, nil
+}
+
+func (m *manifest) get(name string) (ManifestEntry, bool) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	e, ok := m.entries[name]
+	return e, ok
+}
+
+func (m *manifest) put(name string, e ManifestEntry) error {
+	return m.update(func(entries map[string]ManifestEntry) {
+		entries[name] = e
+	})
+}
+
+func (m *manifest) remove(name string) error {
+	return m.update(func(entries map[string]ManifestEntry) {
+		delete(entries, name)
+	})
+}
+
+// update applies f to manifest under lock file. Manifest is read again before
+// f, so changes of other processes sharing tile directory are not lost
+func (m *manifest) update(f func(entries map[string]ManifestEntry)) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	l, err := lock(m.path+".lock", manifestLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer l.unlock()
+	if b, err := ioutil.ReadFile(m.path); err == nil {
+		entries := make(map[string]ManifestEntry)
+		if err := json.Unmarshal(b, &entries); err == nil {
+			for name, e := range entries {
+				// access times of this process are newer than saved ones
+				if old, ok := m.entries[name]; ok && old.SHA256 == e.SHA256 && old.Access.After(e.Access) {
+					e.Access = old.Access
+					entries[name] = e
+				}
+			}
+			m.entries = entries
+		}
+	}
+	f(m.entries)
+	if err := m.save(); err != nil {
+		return err
+	}
+	m.dirty = false
+	return nil
+}
+
+// replace moves entry of tile file name to converted tile file path
+// with checksum of converted file
+func (m *manifest) replace(name, path string) error {
+	sum, size, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	return m.update(func(entries map[string]ManifestEntry) {
+		e, ok := entries[name]
+		if !ok {
+			// tile is not downloaded, previous entry of path is stale
+			delete(entries, filepath.Base(path))
+			return
+		}
+		delete(entries, name)
+		e.Size, e.SHA256 = size, sum
+		entries[filepath.Base(path)] = e
+	})
+}
+
+// touch updates access time of downloaded tile in memory. Access times are
+// saved with next update of manifest or flush
+func (m *manifest) touch(name string, at time.Time) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	e, ok := m.entries[name]
+	if !ok || !at.After(e.Access) {
+		return
+	}
+	e.Access = at
+	m.entries[name] = e
+	m.dirty = true
+}
+
+// flush saves access times of tiles
+func (m *manifest) flush() error {
+	m.mtx.Lock()
+	dirty := m.dirty
+	m.mtx.Unlock()
+	if !dirty {
+		return nil
+	}
+	return m.update(func(map[string]ManifestEntry) {})
+}
+
+// size returns total size of downloaded tiles
+func (m *manifest) size() int64 {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	total := int64(0)
+	for _, e := range m.entries {
+		total += e.Size
+	}
+	return total
+}
+
+// evict removes least recently used downloaded tiles from tile directory while total
+// size of downloaded tiles exceeds quota. Tiles are kept if keep returns true.
+// Files which do not match checksum of entry (replaced after download) are not
+// removed, only entries of them. evict returns paths of removed tiles
+func (m *manifest) evict(quota int64, keep func(name string) bool) ([]string, error) {
+	removed := make([]string, 0)
+	var rerr error
+	err := m.update(func(entries map[string]ManifestEntry) {
+		names := make([]string, 0, len(entries))
+		total := int64(0)
+		for name, e := range entries {
+			names = append(names, name)
+			total += e.Size
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return entries[names[i]].lastAccess().Before(entries[names[j]].lastAccess())
+		})
+		for _, name := range names {
+			if total <= quota {
+				return
+			}
+			if keep(name) {
+				continue
+			}
+			e := entries[name]
+			path := filepath.Join(filepath.Dir(m.path), name)
+			sum, size, err := fileSHA256(path)
+			switch {
+			case os.IsNotExist(err):
+			case err != nil:
+				rerr = err
+				continue
+			case sum != e.SHA256 || size != e.Size:
+				// file is not downloaded one
+			default:
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					rerr = err
+					continue
+				}
+				removed = append(removed, path)
+			}
+			total -= e.Size
+			delete(entries, name)
+		}
+	})
+	if err != nil {
+		return removed, err
+	}
+	return removed, rerr
+}
+
+// save writes manifest with replace of temporary file. Caller must hold m.mtx
+// and lock file of manifest
+func (m *manifest) save() error {
+	b, err := json.MarshalIndent(m.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(m.path), ".manifest-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	return install(tmp, m.path)
+}
+
+// fileSHA256 returns hex encoded SHA-256 and size of file
+func fileSHA256(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// record adds checksum of downloaded tile file into manifest
+func (m *manifest) record(path, source string) error {
+	sum, size, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	return m.put(filepath.Base(path), ManifestEntry{
+		Size:   size,
+		SHA256: sum,
+		Source: source,
+		Time:   time.Now().UTC(),
+	})
+}
+
+// verify checks tile file against manifest entry (if exists) and size of raw tile.
+// Checksum is computed once for size and modification time of file.
+// If deep is true checksum is computed again and compressed tile is decoded
+// with check of CRC and size
+func (m *manifest) verify(path string, info os.FileInfo, deep bool) error {
+	name := filepath.Base(path)
+	if e, ok := m.get(name); ok {
+		if info.Size() != e.Size {
+			return errors.Wrapf(ErrCorruptTile, "%s has size %d instead of %d", path, info.Size(), e.Size)
+		}
+		m.mtx.Lock()
+		v, ok := m.verified[name]
+		m.mtx.Unlock()
+		if deep || !ok || v.size != info.Size() || !v.modTime.Equal(info.ModTime()) || v.sha256 != e.SHA256 {
+			sum, _, err := fileSHA256(path)
+			if err != nil {
+				return err
+			}
+			if sum != e.SHA256 {
+				return errors.Wrapf(ErrCorruptTile, "%s has sha256 %s instead of %s", path, sum, e.SHA256)
+			}
+			m.mtx.Lock()
+			m.verified[name] = verifiedFile{
+				size:    info.Size(),
+				modTime: info.ModTime(),
+				sha256:  sum,
+			}
+			m.mtx.Unlock()
+		}
+	}
+	format := tileFormat(path)
+	if !format.compressed() {
+		if _, _, err := Meta(path, info.Size()); err != nil {
+			return errors.Wrapf(ErrCorruptTile, "%s: %s", path, err.Error())
+		}
+		return nil
+	}
+	if !deep {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := decompress(format, f)
+	if err != nil {
+		return errors.Wrapf(ErrCorruptTile, "%s: %s", path, err.Error())
+	}
+	defer zr.Close()
+	size, err := io.Copy(ioutil.Discard, zr)
+	if err != nil {
+		return errors.Wrapf(ErrCorruptTile, "%s: %s", path, err.Error())
+	}
+	if _, _, err := Meta(path, size); err != nil {
+		return errors.Wrapf(ErrCorruptTile, "%s: %s", path, err.Error())
+	}
+	return nil
+}
+
+// quarantine moves corrupt tile file into quarantine directory of tile directory
+// and removes it from manifest
+func (m *manifest) quarantine(path string) (string, error) {
+	dir := filepath.Join(filepath.Dir(path), quarantineName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := filepath.Base(path)
+	dest := filepath.Join(dir, name+"."+time.Now().UTC().Format("20060102T150405.000000000"))
+	if err := os.Rename(path, dest); err != nil {
+		return "", err
+	}
+	return dest, m.remove(name)
+}
+
+// Verify checks all tile files of tile directory: downloaded tiles are checked
+// against checksums of manifest and all tiles are decoded. Corrupt tiles get
+// Error in result and are moved into quarantine directory if quarantine is true
+func (d *SRTM) Verify(quarantine bool) ([]TileInfo, error) {
+	tiles, err := d.Inventory()
+	if err != nil {
+		return nil, err
+	}
+	for i := range tiles {
+		t := &tiles[i]
+		if len(t.Error) == 0 {
+			info, err := os.Stat(t.Path)
+			if err != nil {
+				return nil, err
+			}
+			if err := d.manifest.verify(t.Path, info, true); err != nil {
+				t.Error = err.Error()
+			}
+		}
+		if len(t.Error) == 0 || !quarantine {
+			continue
+		}
+		d.mtx.Lock()
+		dest, err := d.manifest.quarantine(t.Path)
+		if err == nil {
+			d.cache.Remove(t.Key)
+		}
+		d.mtx.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		d.log.Warn("quarantine corrupt tile", "tile path", t.Path, "quarantine path", dest, "error", t.Error)
+	}
+	return tiles, nil
+}
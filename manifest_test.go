@@ -0,0 +1,177 @@
+package srtm
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testViewfinder returns stand-in of viewfinderpanoramas with N10E010 tile in /dem3/C32.zip
+func testViewfinder(t testing.TB, requests *int32) *httptest.Server {
+	tile := make([]byte, 1201*1201*2)
+	for i := 1; i < len(tile); i += 2 {
+		tile[i] = 100
+	}
+	archive := testZip(t, map[string][]byte{"C32/N10E010.hgt": tile})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if r.URL.Path != "/dem3/C32.zip" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(archive)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testSRTM(t testing.TB, dir string, server *httptest.Server, opts ...Option) *SRTM {
+	data, err := NewWithOptions(append([]Option{
+		WithTileDirectory(dir),
+		WithExpiration(-1),
+		WithHTTPClient(server.Client()),
+		WithProviders(&viewfinderProvider{baseURL: server.URL + "/dem3"}),
+		WithDownloadRetries(0),
+	}, opts...)...)
+	require.NoError(t, err)
+	t.Cleanup(data.Destroy)
+	return data
+}
+
+func TestManifest_Download(t *testing.T) {
+	var requests int32
+	dir := t.TempDir()
+	server := testViewfinder(t, &requests)
+	data := testSRTM(t, dir, server)
+	point, err := data.AddElevation([]float64{10.5, 10.5})
+	require.NoError(t, err)
+	require.Equal(t, []float64{10.5, 10.5, 100}, point)
+	m, err := loadManifest(dir)
+	require.NoError(t, err)
+	e, ok := m.get("N10E010.hgt")
+	require.True(t, ok)
+	require.Equal(t, "viewfinder", e.Source)
+	require.Equal(t, int64(1201*1201*2), e.Size)
+	sum, _, err := fileSHA256(filepath.Join(dir, "N10E010.hgt"))
+	require.NoError(t, err)
+	require.Equal(t, sum, e.SHA256)
+	tiles, err := data.Inventory()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(tiles))
+	require.Equal(t, "viewfinder", tiles[0].Source)
+}
+
+func TestManifest_CorruptTileRedownload(t *testing.T) {
+	var requests int32
+	dir := t.TempDir()
+	server := testViewfinder(t, &requests)
+	_, err := testSRTM(t, dir, server).AddElevation([]float64{10.5, 10.5})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), requests)
+	// corrupt tile with the same size
+	f, err := os.OpenFile(filepath.Join(dir, "N10E010.hgt"), os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{0x7f, 0x7f}, 1000)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	data := testSRTM(t, dir, server)
+	point, err := data.AddElevation([]float64{10.5, 10.5})
+	require.NoError(t, err)
+	require.Equal(t, []float64{10.5, 10.5, 100}, point)
+	require.Equal(t, int32(2), requests)
+	quarantined, err := ioutil.ReadDir(filepath.Join(dir, quarantineName))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(quarantined))
+}
+
+func TestManifest_CorruptTileOffline(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "N10E010.hgt"), make([]byte, 1000), 0644))
+	data, err := NewWithOptions(
+		WithTileDirectory(dir),
+		WithExpiration(-1),
+		WithOffline(true),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	_, err = data.AddElevation([]float64{10.5, 10.5})
+	require.ErrorIs(t, err, ErrCorruptTile)
+	_, err = os.Stat(filepath.Join(dir, "N10E010.hgt"))
+	require.True(t, os.IsNotExist(err))
+	_, err = data.AddElevation([]float64{10.5, 10.5})
+	require.ErrorIs(t, err, ErrTileNotFound)
+}
+
+func TestManifest_ReadErrorNotQuarantined(t *testing.T) {
+	dir := t.TempDir()
+	// reading of directory fails with error of file system like EMFILE or EACCES
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "N10E010.hgt.gz"), 0755))
+	data, err := NewWithOptions(
+		WithTileDirectory(dir),
+		WithExpiration(-1),
+		WithOffline(true),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	_, err = data.AddElevation([]float64{10.5, 10.5})
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrCorruptTile))
+	_, err = os.Stat(filepath.Join(dir, "N10E010.hgt.gz"))
+	require.NoError(t, err)
+}
+
+func TestManifest_VerifyCached(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestTile(t, dir, "N10E010", 100)
+	m := testManifest(t, dir)
+	require.NoError(t, m.record(path, "test"))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, m.verify(path, info, false))
+	// content is changed with the same size and modification time
+	writeTestTile(t, dir, "N10E010", 200)
+	require.NoError(t, os.Chtimes(path, info.ModTime(), info.ModTime()))
+	require.NoError(t, m.verify(path, info, false))
+	require.ErrorIs(t, m.verify(path, info, true), ErrCorruptTile)
+	modified := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(path, modified, modified))
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	require.ErrorIs(t, m.verify(path, info, false), ErrCorruptTile)
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTile(t, dir, "N10E010", 100)
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "S46W066.hgt.gz"))
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "S46W066.hgt.gz"), b[:len(b)/2], 0644))
+	data, err := NewWithOptions(
+		WithTileDirectory(dir),
+		WithExpiration(-1),
+		WithOffline(true),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	for _, quarantine := range []bool{false, true} {
+		tiles, err := data.Verify(quarantine)
+		require.NoError(t, err)
+		require.Equal(t, 2, len(tiles))
+		require.Equal(t, "N10E010", tiles[0].Key)
+		require.Empty(t, tiles[0].Error)
+		require.Equal(t, "S46W066", tiles[1].Key)
+		require.NotEmpty(t, tiles[1].Error)
+	}
+	tiles, err := data.Verify(false)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(tiles))
+}
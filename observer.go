@@ -0,0 +1,30 @@
+package srtm
+
+import "time"
+
+// Observer receives events of tiles cache (for metrics, tracing and so on).
+// Methods are called synchronously, some of them under internal lock, so
+// implementation must be fast and safe for concurrent use
+type Observer interface {
+	// CacheHit is called when tile found in cache
+	CacheHit(key string)
+	// CacheMiss is called when tile not found in cache and will be loaded
+	CacheMiss(key string)
+	// CacheEvict is called when tile removed from cache
+	CacheEvict(key string)
+	// TileLoad is called when tile file loaded into cache
+	TileLoad(key string, format TileFormat, duration time.Duration)
+	// TileBad is called when tile marked as bad
+	TileBad(key string)
+	// Download is called after attempt of download of missing tile
+	Download(key string, duration time.Duration, err error)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) CacheHit(string)                            {}
+func (nopObserver) CacheMiss(string)                           {}
+func (nopObserver) CacheEvict(string)                          {}
+func (nopObserver) TileLoad(string, TileFormat, time.Duration) {}
+func (nopObserver) TileBad(string)                             {}
+func (nopObserver) Download(string, time.Duration, error)      {}
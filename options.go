@@ -0,0 +1,209 @@
+package srtm
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// Option is a functional option of SRTM
+type Option func(o *options)
+
+type options struct {
+	lruCacheSize  int
+	tileDirectory string
+	expiration    time.Duration
+	download      bool
+	workers       int
+	datum         Datum
+	geoid         *Geoid
+	fill          *float64
+	logger        Logger
+	observer      Observer
+	offline       bool
+	fallback      *float64
+	diskQuota     int64
+	maxPreload    int
+
+	httpClient          *http.Client
+	providers           []Provider
+	downloadConcurrency int
+	downloadRetries     int
+	maxDownloadSize     int64
+}
+
+func defaultOptions() *options {
+	return &options{
+		lruCacheSize:  1000,
+		tileDirectory: "./data/",
+		expiration:    time.Minute,
+		download:      true,
+		workers:       runtime.NumCPU(),
+		maxPreload:    defaultMaxPreload,
+		datum:         DatumEGM96,
+		logger:        NopLogger(),
+		observer:      nopObserver{},
+
+		httpClient:          client(),
+		providers:           []Provider{ImagicoProvider()},
+		downloadConcurrency: defaultDownloadConcurrency,
+		downloadRetries:     defaultDownloadRetries,
+		maxDownloadSize:     defaultMaxDownloadSize,
+	}
+}
+
+// WithLRUCacheSize sets max count of tiles in LRU cache (1000 by default)
+func WithLRUCacheSize(lruCacheSize int) Option {
+	return func(o *options) {
+		o.lruCacheSize = lruCacheSize
+	}
+}
+
+// WithExpiration sets expiration time of unused tiles in LRU cache
+// (1 minute by default). Zero or negative expiration disables expiration
+func WithExpiration(expiration time.Duration) Option {
+	return func(o *options) {
+		o.expiration = expiration
+	}
+}
+
+// WithTileDirectory sets directory of hgt-tiles ("./data/" by default)
+func WithTileDirectory(tileDirectory string) Option {
+	return func(o *options) {
+		o.tileDirectory = tileDirectory
+	}
+}
+
+// WithDownload enables or disables auto-download of missing tiles (enabled by default)
+func WithDownload(download bool) Option {
+	return func(o *options) {
+		o.download = download
+	}
+}
+
+// WithOffline enables offline mode. In offline mode SRTM never touches the network,
+// missing tile returns ErrTileNotFound (or fallback elevation, see WithFallbackElevation)
+// and is not marked as bad, so tile files can be added into tile directory at runtime
+func WithOffline(offline bool) Option {
+	return func(o *options) {
+		o.offline = offline
+	}
+}
+
+// WithFallbackElevation sets orthometric elevation of locations in missing tiles
+// (ErrTileNotFound), for example 0 for ocean
+func WithFallbackElevation(elevation float64) Option {
+	return func(o *options) {
+		o.fallback = &elevation
+	}
+}
+
+// WithWorkers sets size of workers pool shared between all AddElevations calls
+// (runtime.NumCPU() by default)
+func WithWorkers(workers int) Option {
+	return func(o *options) {
+		o.workers = workers
+	}
+}
+
+// WithDatum sets default vertical datum of elevations (DatumEGM96 by default)
+func WithDatum(datum Datum) Option {
+	return func(o *options) {
+		o.datum = datum
+	}
+}
+
+// WithGeoid sets geoid grid for conversion between orthometric and ellipsoidal heights.
+// Geoid grid is not embedded, DatumWGS84 requires grid loaded by LoadGeoid (egm96-15.pgm)
+func WithGeoid(geoid *Geoid) Option {
+	return func(o *options) {
+		o.geoid = geoid
+	}
+}
+
+// WithFillValue sets elevation for failed coordinates of AddElevations
+// (failed coordinates keeps original 2D coordinate by default)
+func WithFillValue(fill float64) Option {
+	return func(o *options) {
+		o.fill = &fill
+	}
+}
+
+// WithLogger sets logger of SRTM (NopLogger by default).
+// Use NewZerologLogger for zerolog or pass *slog.Logger as is
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		if logger != nil {
+			o.logger = logger
+		}
+	}
+}
+
+// WithObserver sets observer of tiles cache events (no-op by default)
+func WithObserver(observer Observer) Option {
+	return func(o *options) {
+		if observer != nil {
+			o.observer = observer
+		}
+	}
+}
+
+// WithDownloadConcurrency sets max number of parallel downloads of archives (2 by default)
+func WithDownloadConcurrency(n int) Option {
+	return func(o *options) {
+		o.downloadConcurrency = n
+	}
+}
+
+// WithDownloadRetries sets number of retries of failed download requests with
+// exponential backoff (3 by default)
+func WithDownloadRetries(n int) Option {
+	return func(o *options) {
+		o.downloadRetries = n
+	}
+}
+
+// WithMaxPreload sets max count of tiles pinned in memory by Preload (1000 by default)
+func WithMaxPreload(n int) Option {
+	return func(o *options) {
+		o.maxPreload = n
+	}
+}
+
+// WithDiskQuota sets limit in bytes of total size of downloaded tiles in tile
+// directory. Least recently used downloaded tiles are removed from tile directory
+// when quota is exceeded. Tiles provided by user (not downloaded) are never removed.
+// Zero quota disables limit (by default)
+func WithDiskQuota(quota int64) Option {
+	return func(o *options) {
+		o.diskQuota = quota
+	}
+}
+
+// WithMaxDownloadSize sets size limit in bytes of downloaded archive and
+// total size of tiles extracted from it (1 GiB by default)
+func WithMaxDownloadSize(size int64) Option {
+	return func(o *options) {
+		o.maxDownloadSize = size
+	}
+}
+
+// WithHTTPClient sets http client of tile downloads. Default client verifies
+// TLS certificates, uses proxy from environment and has 5 minutes timeout
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		if client != nil {
+			o.httpClient = client
+		}
+	}
+}
+
+// WithProviders sets providers of tile downloads in priority order
+// (ImagicoProvider by default)
+func WithProviders(providers ...Provider) Option {
+	return func(o *options) {
+		if len(providers) > 0 {
+			o.providers = providers
+		}
+	}
+}
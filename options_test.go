@@ -0,0 +1,172 @@
+package srtm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	geojson "github.com/paulmach/go.geojson"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	data, err := NewWithOptions(
+		WithTileDirectory("testdata"),
+		WithLRUCacheSize(1),
+		WithExpiration(-1),
+		WithDownload(false),
+		WithWorkers(2),
+		WithFillValue(-1),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	require.Equal(t, 2, data.pool.getSize())
+	multiPoint := geojson.NewMultiPointGeometry([]float64{-65.9, -45.1}, []float64{10.5, 10.5})
+	err = data.AddElevations(multiPoint, false)
+	var errs PointErrors
+	require.ErrorAs(t, err, &errs)
+	require.Equal(t, 1, len(errs))
+	require.Contains(t, errs[0].Error(), "is not exists")
+	require.Equal(t, 3, len(multiPoint.MultiPoint[0]))
+	require.Equal(t, []float64{10.5, 10.5, -1}, multiPoint.MultiPoint[1])
+}
+
+func TestNewWithOptions_Datum(t *testing.T) {
+	values := make([]uint16, 12)
+	for i := range values {
+		values[i] = 220
+	}
+	data, err := NewWithOptions(
+		WithTileDirectory("testdata"),
+		WithDownload(false),
+		WithGeoid(testGeoid(t, values)),
+		WithDatum(DatumWGS84),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	ellipsoidal, err := data.AddElevation([]float64{-65.9, -45.1})
+	require.NoError(t, err)
+	orthometric, err := data.AddElevationWithDatum([]float64{-65.9, -45.1}, DatumEGM96)
+	require.NoError(t, err)
+	require.InDelta(t, 10, ellipsoidal[2]-orthometric[2], 1e-9)
+}
+
+type countObserver struct {
+	hits, misses, evicts, loads, bads int
+	formats                           []TileFormat
+}
+
+func (c *countObserver) CacheHit(string)   { c.hits++ }
+func (c *countObserver) CacheMiss(string)  { c.misses++ }
+func (c *countObserver) CacheEvict(string) { c.evicts++ }
+func (c *countObserver) TileLoad(_ string, format TileFormat, _ time.Duration) {
+	c.loads++
+	c.formats = append(c.formats, format)
+}
+func (c *countObserver) TileBad(string)                        { c.bads++ }
+func (c *countObserver) Download(string, time.Duration, error) {}
+
+func TestWithObserver(t *testing.T) {
+	o := &countObserver{}
+	data, err := NewWithOptions(
+		WithTileDirectory("testdata"),
+		WithDownload(false),
+		WithExpiration(-1),
+		WithObserver(o),
+	)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = data.AddElevation([]float64{-65.9, -45.1})
+		require.NoError(t, err)
+	}
+	_, err = data.AddElevation([]float64{10.5, 10.5})
+	require.Error(t, err)
+	data.Destroy()
+	require.Equal(t, 2, o.hits)
+	require.Equal(t, 2, o.misses)
+	require.Equal(t, 1, o.loads)
+	require.Equal(t, []TileFormat{FormatHGTGzip}, o.formats)
+	require.Equal(t, 1, o.bads)
+	require.Equal(t, 1, o.evicts)
+}
+
+func TestWithOffline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s in offline mode", r.URL)
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	data, err := NewWithOptions(
+		WithTileDirectory(dir),
+		WithExpiration(-1),
+		WithOffline(true),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	data.downloader.providers = []Provider{testImagicoProvider(server)}
+	_, err = data.AddElevation([]float64{10.5, 10.5})
+	require.ErrorIs(t, err, ErrTileNotFound)
+	require.Empty(t, data.bads)
+	writeTestTile(t, dir, "N10E010", 100)
+	point, err := data.AddElevation([]float64{10.5, 10.5})
+	require.NoError(t, err)
+	require.Equal(t, []float64{10.5, 10.5, 100}, point)
+}
+
+func TestWithFallbackElevation(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTile(t, dir, "N10E010", 100)
+	data, err := NewWithOptions(
+		WithTileDirectory(dir),
+		WithExpiration(-1),
+		WithOffline(true),
+		WithFallbackElevation(0),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	point, err := data.AddElevation([]float64{11.5, 10.5})
+	require.NoError(t, err)
+	require.Equal(t, []float64{11.5, 10.5, 0}, point)
+	multiPoint := geojson.NewMultiPointGeometry([]float64{10.5, 10.5}, []float64{11.5, 10.5})
+	require.NoError(t, data.AddElevations(multiPoint, false))
+	require.Equal(t, [][]float64{{10.5, 10.5, 100}, {11.5, 10.5, 0}}, multiPoint.MultiPoint)
+	bbox, err := ParseBBox("10.99,10.5,11.01,10.5")
+	require.NoError(t, err)
+	grid, err := data.Window(bbox)
+	require.NoError(t, err)
+	require.Equal(t, 1, grid.Rows)
+	for _, v := range grid.Elevations {
+		require.Contains(t, []int16{0, 100}, v)
+	}
+	require.Equal(t, int16(100), grid.Elevations[0])
+	require.Equal(t, int16(0), grid.Elevations[len(grid.Elevations)-1])
+}
+
+func TestWithFallbackElevation_BadTile(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTile(t, dir, "N10E010", 100)
+	data, err := NewWithOptions(
+		WithTileDirectory(dir),
+		WithExpiration(-1),
+		WithDownload(false),
+		WithFallbackElevation(0),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	bbox, err := ParseBBox("10.99,10.5,11.01,10.5")
+	require.NoError(t, err)
+	// missing tile is marked as bad on first lookup
+	for i := 0; i < 2; i++ {
+		point, err := data.AddElevation([]float64{11.5, 10.5})
+		require.NoError(t, err)
+		require.Equal(t, []float64{11.5, 10.5, 0}, point)
+		multiPoint := geojson.NewMultiPointGeometry([]float64{10.5, 10.5}, []float64{11.5, 10.5})
+		require.NoError(t, data.AddElevations(multiPoint, false))
+		require.Equal(t, [][]float64{{10.5, 10.5, 100}, {11.5, 10.5, 0}}, multiPoint.MultiPoint)
+		grid, err := data.Window(bbox)
+		require.NoError(t, err)
+		require.Equal(t, int16(0), grid.Elevations[len(grid.Elevations)-1])
+	}
+	require.Equal(t, []string{"N10E011"}, data.Stats().Bads)
+}
@@ -0,0 +1,135 @@
+package srtm
+
+import (
+	"sync"
+)
+
+const (
+	// chunkSize is a number of coordinates processed by one task of pool
+	chunkSize = 64
+	// inlineSize is a max number of coordinates processed without pool
+	inlineSize = 16
+)
+
+// pool is a bounded pool of workers shared between all bulk requests of SRTM.
+// Every request splits work into chunks and keeps in queue not more chunks than
+// workers count, so concurrent requests are interleaved in FIFO order.
+// Requests are blocked while queue is full (back-pressure)
+type pool struct {
+	tasks   chan func()
+	quit    chan struct{}
+	done    chan struct{}
+	mtx     sync.RWMutex
+	closed  bool
+	sizeMtx sync.Mutex
+	size    int
+}
+
+func newPool(size int) *pool {
+	if size < 1 {
+		size = 1
+	}
+	p := &pool{
+		tasks: make(chan func(), size),
+		quit:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	p.resize(size)
+	return p
+}
+
+func (p *pool) worker() {
+	for {
+		select {
+		case task := <-p.tasks:
+			task()
+		case <-p.quit:
+			return
+		case <-p.done:
+			// all submitted tasks must be executed for release of waiting requests
+			for {
+				select {
+				case task := <-p.tasks:
+					task()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *pool) getSize() int {
+	p.sizeMtx.Lock()
+	defer p.sizeMtx.Unlock()
+	return p.size
+}
+
+// resize starts or stops workers for achieve requested workers count
+func (p *pool) resize(size int) {
+	if size < 1 {
+		size = 1
+	}
+	p.sizeMtx.Lock()
+	defer p.sizeMtx.Unlock()
+	for ; p.size < size; p.size++ {
+		go p.worker()
+	}
+	for ; p.size > size; p.size-- {
+		select {
+		case p.quit <- struct{}{}:
+		case <-p.done:
+		}
+	}
+}
+
+// close stops all workers after execution of submitted tasks
+func (p *pool) close() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.done)
+}
+
+// submit puts task into queue or executes task in calling goroutine if pool is closed
+func (p *pool) submit(task func()) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	if p.closed {
+		task()
+		return
+	}
+	p.tasks <- task
+}
+
+// run calls fn for all indexes [0, n) on workers of pool and waits for completion.
+// Small jobs are processed inline in calling goroutine
+func (p *pool) run(n int, fn func(i int)) {
+	if n <= inlineSize {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+	inflight := make(chan struct{}, p.getSize())
+	wg := sync.WaitGroup{}
+	for from := 0; from < n; from += chunkSize {
+		from, to := from, from+chunkSize
+		if to > n {
+			to = n
+		}
+		inflight <- struct{}{}
+		wg.Add(1)
+		p.submit(func() {
+			defer wg.Done()
+			for i := from; i < to; i++ {
+				fn(i)
+			}
+			<-inflight
+		})
+	}
+	wg.Wait()
+}
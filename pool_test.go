@@ -0,0 +1,66 @@
+package srtm
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool_Run(t *testing.T) {
+	p := newPool(4)
+	defer p.close()
+	var running, maxRunning int32
+	processed := make([]int32, 1000)
+	p.run(len(processed), func(i int) {
+		r := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if r <= m || atomic.CompareAndSwapInt32(&maxRunning, m, r) {
+				break
+			}
+		}
+		time.Sleep(time.Microsecond)
+		atomic.AddInt32(&processed[i], 1)
+		atomic.AddInt32(&running, -1)
+	})
+	for i := range processed {
+		require.Equal(t, int32(1), processed[i], "index %d", i)
+	}
+	require.True(t, maxRunning <= 4, "max running %d", maxRunning)
+}
+
+func TestPool_Concurrent(t *testing.T) {
+	p := newPool(2)
+	defer p.close()
+	wg := sync.WaitGroup{}
+	var total int32
+	for r := 0; r < 50; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.run(300, func(i int) {
+				atomic.AddInt32(&total, 1)
+			})
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(50*300), total)
+}
+
+func TestPool_Resize(t *testing.T) {
+	p := newPool(1)
+	p.resize(8)
+	require.Equal(t, 8, p.getSize())
+	p.resize(2)
+	require.Equal(t, 2, p.getSize())
+	p.close()
+	// closed pool processes tasks inline
+	var total int32
+	p.run(100, func(i int) {
+		atomic.AddInt32(&total, 1)
+	})
+	require.Equal(t, int32(100), total)
+}
@@ -0,0 +1,117 @@
+package srtm
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrPreloadLimit is returned by Preload when count of preloaded tiles exceeds
+// limit of WithMaxPreload
+var ErrPreloadLimit = errors.New("preload limit exceeded")
+
+const defaultMaxPreload = 1000
+
+// Preload downloads (if enabled) and loads all tiles of bbox into cache and pins
+// them in memory, so they are not evicted until Release of returned keys.
+// Missing tiles are skipped (and marked as bad). Preload returns keys of pinned tiles
+// (also on cancel of ctx), each key must be released once
+func (d *SRTM) Preload(ctx context.Context, bbox BBox) ([]string, error) {
+	tiles := bbox.tiles()
+	d.mtx.Lock()
+	added := 0
+	for _, ll := range tiles {
+		if _, ok := d.preloaded[tileKey(ll)]; !ok {
+			added++
+		}
+	}
+	if len(d.preloaded)+added > d.maxPreload {
+		d.mtx.Unlock()
+		return nil, errors.Wrapf(ErrPreloadLimit, "bbox %s has %d tiles, %d tiles are preloaded (limit %d)", bbox.String(), added, len(d.preloaded), d.maxPreload)
+	}
+	// tiles are reserved before loading, so concurrent preloads can't exceed limit
+	for _, ll := range tiles {
+		d.preloaded[tileKey(ll)]++
+	}
+	d.mtx.Unlock()
+	keys := make([]string, 0)
+	var err error
+	for _, ll := range tiles {
+		key := tileKey(ll)
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err == nil {
+			_, perr := d.pinTile(ll)
+			if perr == nil {
+				keys = append(keys, key)
+				continue
+			}
+			d.log.Warn("preload", "key", key, "error", perr)
+		}
+		d.mtx.Lock()
+		d.unreserve(key)
+		d.mtx.Unlock()
+	}
+	d.log.Info("preload", "bbox", bbox.String(), "tiles", len(keys))
+	return keys, err
+}
+
+// Release unpins tiles by keys returned by Preload. Keys which are not preloaded are ignored
+func (d *SRTM) Release(keys []string) {
+	for _, key := range keys {
+		d.mtx.Lock()
+		if _, ok := d.preloaded[key]; ok {
+			d.unreserve(key)
+			d.unpinKeyLocked(key)
+		}
+		d.mtx.Unlock()
+	}
+}
+
+// unreserve decrements count of preloads of tile. Caller must hold d.mtx
+func (d *SRTM) unreserve(key string) {
+	d.preloaded[key]--
+	if d.preloaded[key] <= 0 {
+		delete(d.preloaded, key)
+	}
+}
+
+// Fetch downloads (if enabled) missing tiles of bbox into tile directory one by one
+// without loading them into memory. Tile files are checked against manifest, missing
+// tiles are marked as bad. Fetch returns keys of tiles in tile directory
+func (d *SRTM) Fetch(ctx context.Context, bbox BBox) ([]string, error) {
+	keys := make([]string, 0)
+	for _, ll := range bbox.tiles() {
+		if err := ctx.Err(); err != nil {
+			return keys, err
+		}
+		key := tileKey(ll)
+		tPath, info, err := findTile(d.tileDirectory, ll)
+		if err != nil && d.canDownload() {
+			start := time.Now()
+			tPath, info, err = d.downloader.download(d.tileDirectory, ll)
+			d.observer.Download(key, time.Since(start), err)
+		}
+		if err == nil {
+			err = d.manifest.verify(tPath, info, false)
+		}
+		if errors.Is(err, ErrTileNotFound) && !d.offline {
+			d.mtx.Lock()
+			if i := sort.SearchStrings(d.bads, key); i == len(d.bads) || d.bads[i] != key {
+				d.markBad(key)
+				d.observer.TileBad(key)
+			}
+			d.mtx.Unlock()
+		}
+		if err != nil {
+			d.log.Warn("fetch", "key", key, "error", err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	d.log.Info("fetch", "bbox", bbox.String(), "tiles", len(keys))
+	return keys, nil
+}
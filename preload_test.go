@@ -0,0 +1,116 @@
+package srtm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreload(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTile(t, dir, "N10E010", 100)
+	writeTestTile(t, dir, "N11E010", 200)
+	writeTestTile(t, dir, "N12E010", 300)
+	data, err := NewWithOptions(
+		WithTileDirectory(dir),
+		WithLRUCacheSize(1),
+		WithExpiration(-1),
+		WithDownload(false),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	bbox, err := ParseBBox("10.1,10.1,11.9,11.9")
+	require.NoError(t, err)
+	keys, err := data.Preload(context.Background(), bbox)
+	require.NoError(t, err)
+	require.Equal(t, []string{"N10E010", "N11E010"}, keys)
+	require.Equal(t, []string{"N10E011", "N11E011"}, data.Stats().Bads)
+	// pinned tiles are not reloaded after eviction by third tile
+	_, err = data.AddElevation([]float64{10.5, 12.5})
+	require.NoError(t, err)
+	misses := data.Stats().Misses
+	for _, point := range [][]float64{{10.5, 10.5}, {10.5, 11.5}} {
+		_, err = data.AddElevation(point)
+		require.NoError(t, err)
+	}
+	require.Equal(t, misses, data.Stats().Misses)
+	// tile pinned by bulk processing is not released by keys of preload
+	_, err = data.pinTile(LatLng{Latitude: 10.5, Longitude: 10.5})
+	require.NoError(t, err)
+	data.Release(append(keys, "N10E011"))
+	require.Equal(t, 1, len(data.pinned))
+	require.Equal(t, 0, len(data.preloaded))
+	data.Release(keys)
+	require.Equal(t, 1, data.pinned["N10E010"].refs)
+}
+
+func TestPreload_Limit(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTile(t, dir, "N10E010", 100)
+	data, err := NewWithOptions(
+		WithTileDirectory(dir),
+		WithExpiration(-1),
+		WithDownload(false),
+		WithMaxPreload(2),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	bbox, err := ParseBBox("10.1,10.1,11.9,11.9")
+	require.NoError(t, err)
+	_, err = data.Preload(context.Background(), bbox)
+	require.ErrorIs(t, err, ErrPreloadLimit)
+	require.Equal(t, 0, len(data.pinned))
+	small, err := ParseBBox("10.1,10.1,10.9,10.9")
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		keys, err := data.Preload(context.Background(), small)
+		require.NoError(t, err)
+		require.Equal(t, []string{"N10E010"}, keys)
+	}
+	require.Equal(t, 1, len(data.preloaded))
+}
+
+func TestPreload_Canceled(t *testing.T) {
+	data, err := NewWithOptions(
+		WithTileDirectory(t.TempDir()),
+		WithExpiration(-1),
+		WithDownload(false),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	bbox, err := ParseBBox("10,10,12,12")
+	require.NoError(t, err)
+	keys, err := data.Preload(ctx, bbox)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Empty(t, keys)
+	require.Equal(t, 0, len(data.preloaded))
+}
+
+func TestFetch(t *testing.T) {
+	var requests int32
+	dir := t.TempDir()
+	server := testViewfinder(t, &requests)
+	writeTestTile(t, dir, "N11E010", 200)
+	data := testSRTM(t, dir, server)
+	bbox, err := ParseBBox("10.1,10.1,11.9,11.9")
+	require.NoError(t, err)
+	keys, err := data.Fetch(context.Background(), bbox)
+	require.NoError(t, err)
+	require.Equal(t, []string{"N10E010", "N11E010"}, keys)
+	require.Equal(t, []string{"N10E011", "N11E011"}, data.Stats().Bads)
+	// tiles are downloaded without load into memory
+	require.Empty(t, data.Stats().Tiles)
+	require.Equal(t, uint64(0), data.Stats().Misses)
+	_, err = os.Stat(filepath.Join(dir, "N10E010.hgt"))
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	keys, err = data.Fetch(ctx, bbox)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Empty(t, keys)
+}
@@ -0,0 +1,156 @@
+package srtm
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/cookiejar"
+	"path/filepath"
+	"strings"
+)
+
+// Provider is a source of tile downloads. Providers of SRTM are tried in
+// priority order until tile is downloaded (see WithProviders)
+type Provider interface {
+	// Name returns name of provider for logs
+	Name() string
+	// download downloads tile contains location into tileDir and returns
+	// paths of all downloaded tile files
+	download(d *downloader, tileDir string, ll LatLng) ([]string, error)
+}
+
+// NASADataset is a dataset of NASA SRTM tiles
+type NASADataset string
+
+const (
+	// SRTMGL1 is a NASA SRTM global 1 arc second dataset
+	SRTMGL1 NASADataset = "SRTMGL1"
+	// SRTMGL3 is a NASA SRTM global 3 arc second dataset
+	SRTMGL3 NASADataset = "SRTMGL3"
+)
+
+const (
+	nasaBaseURL       = "https://e4ftl01.cr.usgs.gov/MEASURES"
+	earthdataHost     = "urs.earthdata.nasa.gov"
+	viewfinderBaseURL = "http://viewfinderpanoramas.org/dem3"
+	skadiBaseURL      = "https://s3.amazonaws.com/elevation-tiles-prod/skadi"
+)
+
+// nasaProvider downloads zipped tiles of NASA LP DAAC with Earthdata login
+type nasaProvider struct {
+	dataset   NASADataset
+	username  string
+	password  string
+	baseURL   string
+	loginHost string
+}
+
+// NASAProvider returns provider of NASA SRTMGL1 or SRTMGL3 tiles.
+// Downloads requires Earthdata login (https://urs.earthdata.nasa.gov)
+func NASAProvider(dataset NASADataset, username, password string) Provider {
+	return &nasaProvider{
+		dataset:   dataset,
+		username:  username,
+		password:  password,
+		baseURL:   nasaBaseURL,
+		loginHost: earthdataHost,
+	}
+}
+
+func (p *nasaProvider) Name() string {
+	return "nasa-" + strings.ToLower(string(p.dataset))
+}
+
+// client returns client which keeps cookies of Earthdata session and sends
+// credentials on redirect to Earthdata login only
+func (p *nasaProvider) client(d *downloader) (*http.Client, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	client := *d.client
+	client.Jar = jar
+	client.CheckRedirect = func(r *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after %d redirects", len(via))
+		}
+		if r.URL.Host == p.loginHost {
+			r.SetBasicAuth(p.username, p.password)
+		}
+		return nil
+	}
+	return &client, nil
+}
+
+func (p *nasaProvider) download(d *downloader, tileDir string, ll LatLng) ([]string, error) {
+	client, err := p.client(d)
+	if err != nil {
+		return nil, err
+	}
+	// for example MEASURES/SRTMGL1.003/2000.02.11/N45E006.SRTMGL1.hgt.zip
+	url := fmt.Sprintf("%s/%s.003/2000.02.11/%s.%s.hgt.zip", p.baseURL, p.dataset, tileKey(ll), p.dataset)
+	return d.fetchZip(client, tileDir, url)
+}
+
+// viewfinderProvider downloads DEM3 zips of viewfinderpanoramas
+type viewfinderProvider struct {
+	baseURL string
+}
+
+// ViewfinderProvider returns provider of 3 arc second tiles of
+// viewfinderpanoramas (http://viewfinderpanoramas.org/dem3.html)
+func ViewfinderProvider() Provider {
+	return &viewfinderProvider{
+		baseURL: viewfinderBaseURL,
+	}
+}
+
+func (p *viewfinderProvider) Name() string {
+	return "viewfinder"
+}
+
+// viewfinderZone returns name of DEM3 zip with tile of location. Zips are
+// named by 4 degrees latitude band (A-U) and 6 degrees longitude zone (1-60),
+// bands of southern hemisphere have S prefix (for example J40 or SL19)
+func viewfinderZone(ll LatLng) string {
+	sw := tileSouthWest(ll)
+	prefix := ""
+	band := int(sw.Latitude) / 4
+	if sw.Latitude < 0 {
+		prefix = "S"
+		band = int(-sw.Latitude-1) / 4
+	}
+	zone := int(math.Floor((sw.Longitude+180)/6)) + 1
+	return fmt.Sprintf("%s%c%02d", prefix, 'A'+band, zone)
+}
+
+func (p *viewfinderProvider) download(d *downloader, tileDir string, ll LatLng) ([]string, error) {
+	return d.fetchZip(d.client, tileDir, fmt.Sprintf("%s/%s.zip", p.baseURL, viewfinderZone(ll)))
+}
+
+// skadiProvider downloads gzipped tiles of Skadi layout ({base}/N45/N45E006.hgt.gz)
+type skadiProvider struct {
+	baseURL string
+}
+
+// SkadiProvider returns provider of gzipped 1 arc second tiles in Skadi layout
+// used by public terrain buckets. Empty baseURL means AWS terrain tiles
+// (https://s3.amazonaws.com/elevation-tiles-prod/skadi)
+func SkadiProvider(baseURL string) Provider {
+	if len(baseURL) == 0 {
+		baseURL = skadiBaseURL
+	}
+	return &skadiProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}
+}
+
+func (p *skadiProvider) Name() string {
+	return "skadi"
+}
+
+func (p *skadiProvider) download(d *downloader, tileDir string, ll LatLng) ([]string, error) {
+	key := tileKey(ll)
+	url := fmt.Sprintf("%s/%s/%s.hgt.gz", p.baseURL, key[:3], key)
+	return d.fetchFile(d.client, url, filepath.Join(tileDir, key+".hgt.gz"))
+}
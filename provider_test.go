@@ -0,0 +1,132 @@
+package srtm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testGzip(t testing.TB, b []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(b)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestNASAProvider(t *testing.T) {
+	archive := testZip(t, map[string][]byte{"N45E006.hgt": []byte{1, 2}})
+	var data *httptest.Server
+	login := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, r.URL.Query().Get("redirect")+"?code=ok", http.StatusFound)
+	}))
+	defer login.Close()
+	data = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Empty(t, r.Header.Get("Authorization"), "credentials must be sent to login host only")
+		if r.URL.Path != "/MEASURES/SRTMGL1.003/2000.02.11/N45E006.SRTMGL1.hgt.zip" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if _, err := r.Cookie("session"); err == nil {
+			w.Write(archive)
+			return
+		}
+		if r.URL.Query().Get("code") == "ok" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "ok", Path: "/"})
+			http.Redirect(w, r, r.URL.Path, http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, login.URL+"/oauth?redirect="+url.QueryEscape(data.URL+r.URL.Path), http.StatusFound)
+	}))
+	defer data.Close()
+	loginURL, err := url.Parse(login.URL)
+	require.NoError(t, err)
+	for _, tt := range []struct {
+		password string
+		ok       bool
+	}{
+		{"secret", true},
+		{"wrong", false},
+	} {
+		p := NASAProvider(SRTMGL1, "user", tt.password).(*nasaProvider)
+		p.baseURL = data.URL + "/MEASURES"
+		p.loginHost = loginURL.Host
+		require.Equal(t, "nasa-srtmgl1", p.Name())
+		dir := t.TempDir()
+		d := newDownloader(data.Client(), []Provider{p}, testManifest(t, dir), 1, 0, 1<<20, NopLogger())
+		tPath, _, err := d.download(dir, LatLng{Latitude: 45.5, Longitude: 6.5})
+		if tt.ok {
+			require.NoError(t, err)
+			require.Equal(t, filepath.Join(dir, "N45E006.hgt"), tPath)
+		} else {
+			require.ErrorIs(t, err, ErrTileNotFound)
+			require.Contains(t, err.Error(), "401")
+		}
+	}
+}
+
+func TestViewfinderZone(t *testing.T) {
+	for _, tt := range []struct {
+		ll   LatLng
+		zone string
+	}{
+		{LatLng{Latitude: 36.5, Longitude: 54.5}, "J40"},
+		{LatLng{Latitude: 39.5, Longitude: 59.5}, "J40"},
+		{LatLng{Latitude: 45.5, Longitude: 6.5}, "L32"},
+		{LatLng{Latitude: 0.5, Longitude: -179.5}, "A01"},
+		{LatLng{Latitude: -0.5, Longitude: 179.5}, "SA60"},
+		{LatLng{Latitude: -45.5, Longitude: -65.5}, "SL20"},
+	} {
+		require.Equal(t, tt.zone, viewfinderZone(tt.ll), tt.ll.String())
+	}
+}
+
+func TestProviders_Priority(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/dem3/L32.zip":
+			w.Write(testZip(t, map[string][]byte{"L32/N45E006.hgt": []byte{1, 2}, "L32/N44E006.hgt": []byte{3, 4}}))
+		case "/skadi/N46/N46E006.hgt.gz":
+			w.Write(testGzip(t, []byte{5, 6}))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	d := newDownloader(server.Client(), []Provider{
+		SkadiProvider(server.URL + "/skadi/"),
+		&viewfinderProvider{baseURL: server.URL + "/dem3"},
+	}, testManifest(t, dir), 1, 0, 1<<20, NopLogger())
+
+	tPath, _, err := d.download(dir, LatLng{Latitude: 45.5, Longitude: 6.5})
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "N45E006.hgt"), tPath)
+	require.Equal(t, []string{"/skadi/N45/N45E006.hgt.gz", "/dem3/L32.zip"}, requests)
+	_, err = os.Stat(filepath.Join(dir, "N44E006.hgt"))
+	require.NoError(t, err)
+
+	requests = nil
+	tPath, _, err = d.download(dir, LatLng{Latitude: 46.5, Longitude: 6.5})
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "N46E006.hgt.gz"), tPath)
+	require.Equal(t, []string{"/skadi/N46/N46E006.hgt.gz"}, requests)
+	b, err := ioutil.ReadFile(tPath)
+	require.NoError(t, err)
+	require.Equal(t, testGzip(t, []byte{5, 6}), b)
+}
@@ -0,0 +1,37 @@
+package srtm
+
+import "sync/atomic"
+
+// enforceDiskQuota removes least recently used downloaded tiles from tile directory
+// when total size of downloaded tiles exceeds disk quota after load of tile. Tiles in
+// memory (cached or pinned) are most recently used, so they are kept. Keys of them are
+// taken under d.mtx, eviction (lock file of manifest and checksums of tiles) runs
+// without d.mtx, so lookups are not blocked. Caller must not hold d.mtx
+func (d *SRTM) enforceDiskQuota() {
+	if !atomic.CompareAndSwapInt32(&d.quotaPending, 1, 0) || d.manifest.size() <= d.diskQuota {
+		return
+	}
+	keep := make(map[string]struct{})
+	d.mtx.Lock()
+	d.resident.Range(func(key, _ interface{}) bool {
+		keep[key.(string)] = struct{}{}
+		return true
+	})
+	for key := range d.pinned {
+		keep[key] = struct{}{}
+	}
+	d.mtx.Unlock()
+	removed, err := d.manifest.evict(d.diskQuota, func(name string) bool {
+		if len(name) < 7 {
+			return false
+		}
+		_, ok := keep[name[:7]]
+		return ok
+	})
+	for _, path := range removed {
+		d.log.Info("remove tile by disk quota", "tile path", path, "disk quota", d.diskQuota)
+	}
+	if err != nil {
+		d.log.Error("enforce disk quota", "error", err)
+	}
+}
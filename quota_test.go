@@ -0,0 +1,130 @@
+package srtm
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithDiskQuota(t *testing.T) {
+	tile := testGzip(t, make([]byte, 1201*1201*2))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tile)
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	writeTestTile(t, dir, "N00E000", 100)
+	data, err := NewWithOptions(
+		WithTileDirectory(dir),
+		WithExpiration(-1),
+		WithLRUCacheSize(1),
+		WithHTTPClient(server.Client()),
+		WithProviders(SkadiProvider(server.URL)),
+		WithDiskQuota(int64(len(tile))*5/2),
+	)
+	require.NoError(t, err)
+	exists := func(key string) bool {
+		_, err := os.Stat(filepath.Join(dir, key+".hgt.gz"))
+		return err == nil
+	}
+	for _, lat := range []float64{10.5, 11.5, 12.5} {
+		_, err := data.AddElevation([]float64{10.5, lat})
+		require.NoError(t, err)
+	}
+	// user tile is not counted and not removed
+	_, err = data.AddElevation([]float64{0.5, 0.5})
+	require.NoError(t, err)
+	require.False(t, exists("N10E010"))
+	require.True(t, exists("N11E010"))
+	require.True(t, exists("N12E010"))
+	// N11E010 is loaded from disk and becomes more recently used than N12E010
+	_, err = data.AddElevation([]float64{10.5, 11.5})
+	require.NoError(t, err)
+	_, err = data.AddElevation([]float64{10.5, 13.5})
+	require.NoError(t, err)
+	require.True(t, exists("N11E010"))
+	require.False(t, exists("N12E010"))
+	require.True(t, exists("N13E010"))
+	_, err = os.Stat(filepath.Join(dir, "N00E000.hgt"))
+	require.NoError(t, err)
+	data.Destroy()
+
+	m, err := loadManifest(dir)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(tile))*2, m.size())
+	e, ok := m.get("N11E010.hgt.gz")
+	require.True(t, ok)
+	require.True(t, e.Access.After(e.Time))
+}
+
+func TestWithDiskQuota_UserTiles(t *testing.T) {
+	raw := make([]byte, 1201*1201*2)
+	archive := testZip(t, map[string][]byte{
+		"C32/N10E010.hgt": raw,
+		"C32/N10E011.hgt": raw,
+		"C32/N11E010.hgt": raw,
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	user := writeTestTile(t, dir, "N10E011", 7)
+	data := testSRTM(t, dir, server, WithLRUCacheSize(1), WithDiskQuota(int64(len(raw))/2))
+	// entry of user tile with other checksum (for example tile replaced by user)
+	require.NoError(t, data.manifest.put("N10E011.hgt", ManifestEntry{Size: int64(len(raw)), SHA256: "other"}))
+	_, err := data.AddElevation([]float64{10.5, 10.5})
+	require.NoError(t, err)
+	// user tile is loaded and downloaded tile N10E010 is evicted from memory and disk
+	point, err := data.AddElevation([]float64{11.5, 10.5})
+	require.NoError(t, err)
+	require.Equal(t, 7., point[2])
+	for _, name := range []string{"N10E010.hgt", "N11E010.hgt"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		require.True(t, os.IsNotExist(err), name)
+	}
+	b, err := ioutil.ReadFile(user)
+	require.NoError(t, err)
+	require.Equal(t, byte(7), b[1])
+	require.Equal(t, int64(0), data.manifest.size())
+}
+
+func TestWithDiskQuota_Unlocked(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTile(t, dir, "N00E000", 100)
+	downloaded := writeTestTile(t, dir, "N10E010", 200)
+	data, err := NewWithOptions(
+		WithTileDirectory(dir),
+		WithExpiration(-1),
+		WithOffline(true),
+		WithDiskQuota(1),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	require.NoError(t, data.manifest.record(downloaded, "test"))
+	// other process holds lock of manifest
+	l, err := lock(data.manifest.path+".lock", lockTimeout)
+	require.NoError(t, err)
+	errs := make(chan error, 1)
+	go func() {
+		_, err := data.AddElevation([]float64{0.5, 0.5})
+		errs <- err
+	}()
+	for len(data.Stats().Tiles) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// lookups are not blocked by eviction waiting for lock of manifest
+	point, err := data.AddElevation([]float64{0.5, 0.5})
+	require.NoError(t, err)
+	require.Equal(t, []float64{0.5, 0.5, 100}, point)
+	require.NoError(t, l.unlock())
+	require.NoError(t, <-errs)
+	_, err = os.Stat(downloaded)
+	require.True(t, os.IsNotExist(err))
+}
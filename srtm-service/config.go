@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asmyasnikov/srtm"
+	"github.com/dustin/go-humanize"
+	"github.com/rs/zerolog/log"
+)
+
+// config contains all settings of srtm library
+type config struct {
+	lruCacheSize  int
+	tileDirectory string
+	expiration    time.Duration
+	download      bool
+	workers       int
+	geoidFile     string
+	offline       bool
+	fallback      string
+	providers     string
+	username      string
+	password      string
+	skadiURL      string
+	insecure      bool
+	proxy         string
+	httpTimeout   time.Duration
+	diskQuota     string
+	maxPreload    int
+}
+
+func newConfig() config {
+	return config{
+		lruCacheSize:  lruCacheSize().(int),
+		tileDirectory: tileDirectory().(string),
+		expiration:    expiration().(time.Duration),
+		download:      download().(bool),
+		workers:       workers().(int),
+		geoidFile:     geoidFile().(string),
+		offline:       offline().(bool),
+		fallback:      fallbackElevation().(string),
+		providers:     providers().(string),
+		username:      earthdataUsername().(string),
+		password:      earthdataPassword().(string),
+		skadiURL:      skadiURL().(string),
+		insecure:      insecure().(bool),
+		proxy:         proxy().(string),
+		httpTimeout:   httpTimeout().(time.Duration),
+		diskQuota:     diskQuota().(string),
+		maxPreload:    maxPreload().(int),
+	}
+}
+
+// httpClient returns http client of tile downloads
+func (c config) httpClient() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(c.proxy) > 0 {
+		u, err := url.Parse(c.proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	if c.insecure {
+		log.Warn().Caller().Msg("TLS certificates verification of tile downloads is disabled")
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: true,
+		}
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   c.httpTimeout,
+	}, nil
+}
+
+// tileProviders returns tile download providers in priority order
+func (c config) tileProviders() ([]srtm.Provider, error) {
+	providers := make([]srtm.Provider, 0)
+	for _, name := range strings.Split(c.providers, ",") {
+		switch strings.TrimSpace(strings.ToLower(name)) {
+		case "":
+			continue
+		case "imagico":
+			providers = append(providers, srtm.ImagicoProvider())
+		case "nasa-srtmgl1":
+			providers = append(providers, srtm.NASAProvider(srtm.SRTMGL1, c.username, c.password))
+		case "nasa-srtmgl3":
+			providers = append(providers, srtm.NASAProvider(srtm.SRTMGL3, c.username, c.password))
+		case "viewfinder":
+			providers = append(providers, srtm.ViewfinderProvider())
+		case "skadi":
+			providers = append(providers, srtm.SkadiProvider(c.skadiURL))
+		default:
+			return nil, fmt.Errorf("unknown tile provider '%s'", name)
+		}
+	}
+	return providers, nil
+}
+
+// options returns options of srtm library
+func (c config) options() ([]srtm.Option, error) {
+	client, err := c.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	providers, err := c.tileProviders()
+	if err != nil {
+		return nil, err
+	}
+	opts := []srtm.Option{
+		srtm.WithHTTPClient(client),
+		srtm.WithProviders(providers...),
+		srtm.WithLRUCacheSize(c.lruCacheSize),
+		srtm.WithTileDirectory(c.tileDirectory),
+		srtm.WithExpiration(c.expiration),
+		srtm.WithDownload(c.download),
+		srtm.WithOffline(c.offline),
+		srtm.WithWorkers(c.workers),
+		srtm.WithMaxPreload(c.maxPreload),
+		srtm.WithLogger(srtm.NewZerologLogger(log.Logger)),
+	}
+	if len(c.fallback) > 0 {
+		fallback, err := strconv.ParseFloat(c.fallback, 64)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, srtm.WithFallbackElevation(fallback))
+	}
+	if len(c.diskQuota) > 0 {
+		quota, err := humanize.ParseBytes(c.diskQuota)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, srtm.WithDiskQuota(int64(quota)))
+	}
+	if len(c.geoidFile) > 0 {
+		geoid, err := srtm.LoadGeoid(c.geoidFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, srtm.WithGeoid(geoid))
+	}
+	return opts, nil
+}
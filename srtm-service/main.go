@@ -1,9 +1,16 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/asmyasnikov/srtm"
+	"github.com/asmyasnikov/srtm/export"
 	"github.com/dustin/go-humanize"
 	"github.com/gorilla/mux"
 	geojson "github.com/paulmach/go.geojson"
@@ -14,32 +21,83 @@ import (
 	"net/http"
 	"net/http/pprof"
 	"os"
+	"os/signal"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
+// shutdownTimeout is a timeout of completion of requests on shutdown of web-server
+const shutdownTimeout = 30 * time.Second
+
 var (
 	flags = map[string]interface{}{
-		"debug":          flag.Bool("debug", false, "boolean flag for debug handlers with pprof"),
-		"lru-cache-size": flag.Int("lru-cache-size", 1000, "LRU cache size"),
-		"www":            flag.String("www", "/", "prefix of handlers"),
-		"http-port":      flag.Int("http-port", 80, "http port of web-service"),
-		"tile-directory": flag.String("tile-directory", "./data/", "directory of hgt tiles"),
-		"log-level":      flag.String("log-level", "error", "logging level"),
-		"expiration":     flag.Duration("expiration", time.Minute, "expiration time for tiles in LRU cache"),
+		"debug":              flag.Bool("debug", false, "boolean flag for debug handlers with pprof"),
+		"lru-cache-size":     flag.Int("lru-cache-size", 1000, "LRU cache size"),
+		"www":                flag.String("www", "/", "prefix of handlers"),
+		"http-port":          flag.Int("http-port", 80, "http port of web-service"),
+		"tile-directory":     flag.String("tile-directory", "./data/", "directory of hgt tiles"),
+		"log-level":          flag.String("log-level", "error", "logging level"),
+		"expiration":         flag.Duration("expiration", time.Minute, "expiration time for tiles in LRU cache"),
+		"export-max-area":    flag.Float64("export-max-area", 1, "max area of bbox in square degrees for export and zonal statistics"),
+		"download":           flag.Bool("download", true, "boolean flag for auto-download of missing tiles"),
+		"workers":            flag.Int("workers", runtime.NumCPU(), "size of workers pool shared between requests"),
+		"geoid-file":         flag.String("geoid-file", "", "geoid grid in GeographicLib pgm format (egm96-15.pgm) for ellipsoidal heights"),
+		"offline":            flag.Bool("offline", false, "boolean flag for offline mode without downloads, missing tiles are not marked as bad"),
+		"fallback-elevation": flag.String("fallback-elevation", "", "elevation of locations in missing tiles (for example 0 for ocean), empty for error"),
+		"providers":          flag.String("providers", "imagico", "comma separated list of tile download providers in priority order (imagico, nasa-srtmgl1, nasa-srtmgl3, viewfinder, skadi)"),
+		"earthdata-username": flag.String("earthdata-username", "", "username of NASA Earthdata login for nasa providers"),
+		"earthdata-password": flag.String("earthdata-password", "", "password of NASA Earthdata login for nasa providers"),
+		"skadi-url":          flag.String("skadi-url", "", "base url of skadi provider (AWS terrain tiles by default)"),
+		"insecure":           flag.Bool("insecure", false, "boolean flag for skip of TLS certificates verification of tile downloads"),
+		"proxy":              flag.String("proxy", "", "proxy url of tile downloads (HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables by default)"),
+		"http-timeout":       flag.Duration("http-timeout", 5*time.Minute, "timeout of tile download requests"),
+		"disk-quota":         flag.String("disk-quota", "", "limit of total size of downloaded tiles (for example 2GB), least recently used downloaded tiles are removed, empty for no limit"),
+		"compact":            flag.String("compact", "", "format and optional compression level of background conversion of tile directory on start (for example hgt.zst:19, hgt.gz:9, hgt.blk:3 or hgt)"),
+		"preload":            flag.String("preload", "", "semicolon separated list of bboxes (minLng,minLat,maxLng,maxLat) for preload of tiles on start"),
+		"max-preload":        flag.Int("max-preload", 1000, "max count of tiles pinned in memory by preload"),
+		"admin-token":        flag.String("admin-token", "", "bearer token of admin handlers, empty for disabled admin handlers"),
 	}
 	args = map[string]func() interface{}{
-		"debug":          debug,
-		"lru-cache-size": lruCacheSize,
-		"www":            www,
-		"http-port":      httpPort,
-		"tile-directory": tileDirectory,
-		"log-level":      logLevel,
-		"expiration":     expiration,
+		"debug":              debug,
+		"lru-cache-size":     lruCacheSize,
+		"www":                www,
+		"http-port":          httpPort,
+		"tile-directory":     tileDirectory,
+		"log-level":          logLevel,
+		"expiration":         expiration,
+		"export-max-area":    exportMaxArea,
+		"geoid-file":         geoidFile,
+		"workers":            workers,
+		"download":           download,
+		"preload":            preload,
+		"max-preload":        maxPreload,
+		"admin-token":        adminToken,
+		"insecure":           insecure,
+		"providers":          providers,
+		"earthdata-username": earthdataUsername,
+		"earthdata-password": earthdataPassword,
+		"skadi-url":          skadiURL,
+		"offline":            offline,
+		"fallback-elevation": fallbackElevation,
+		"proxy":              proxy,
+		"http-timeout":       httpTimeout,
+		"disk-quota":         diskQuota,
+		"compact":            compact,
+	}
+	// secrets are args which values are not printed on start
+	secrets = map[string]struct{}{
+		"earthdata-password": {},
+		"admin-token":        {},
 	}
+	// compacting is 1 while compaction of tile directory is running
+	compacting int32
+	// compaction is done when background compaction is stopped
+	compaction sync.WaitGroup
 )
 
 func tileDirectory() interface{} {
@@ -69,6 +127,303 @@ func expiration() interface{} {
 	return time.Minute
 }
 
+func exportMaxArea() interface{} {
+	v := os.Getenv("EXPORT_MAX_AREA")
+	if len(v) > 0 {
+		area, err := strconv.ParseFloat(v, 64)
+		if err == nil {
+			return area
+		}
+	}
+	exportMaxArea := flags["export-max-area"].(*float64)
+	if exportMaxArea != nil {
+		return *exportMaxArea
+	}
+	return 1.
+}
+
+func geoidFile() interface{} {
+	v := os.Getenv("GEOID_FILE")
+	if len(v) > 0 {
+		return v
+	}
+	geoidFile := flags["geoid-file"].(*string)
+	if geoidFile != nil {
+		return *geoidFile
+	}
+	return ""
+}
+
+func offline() interface{} {
+	v := os.Getenv("OFFLINE")
+	if len(v) > 0 {
+		return strings.ToLower(v) == "true"
+	}
+	offline := flags["offline"].(*bool)
+	if offline != nil {
+		return *offline
+	}
+	return false
+}
+
+func fallbackElevation() interface{} {
+	v := os.Getenv("FALLBACK_ELEVATION")
+	if len(v) > 0 {
+		return v
+	}
+	fallback := flags["fallback-elevation"].(*string)
+	if fallback != nil {
+		return *fallback
+	}
+	return ""
+}
+
+func providers() interface{} {
+	v := os.Getenv("PROVIDERS")
+	if len(v) > 0 {
+		return v
+	}
+	providers := flags["providers"].(*string)
+	if providers != nil {
+		return *providers
+	}
+	return "imagico"
+}
+
+func earthdataUsername() interface{} {
+	v := os.Getenv("EARTHDATA_USERNAME")
+	if len(v) > 0 {
+		return v
+	}
+	username := flags["earthdata-username"].(*string)
+	if username != nil {
+		return *username
+	}
+	return ""
+}
+
+func earthdataPassword() interface{} {
+	v := os.Getenv("EARTHDATA_PASSWORD")
+	if len(v) > 0 {
+		return v
+	}
+	password := flags["earthdata-password"].(*string)
+	if password != nil {
+		return *password
+	}
+	return ""
+}
+
+func skadiURL() interface{} {
+	v := os.Getenv("SKADI_URL")
+	if len(v) > 0 {
+		return v
+	}
+	url := flags["skadi-url"].(*string)
+	if url != nil {
+		return *url
+	}
+	return ""
+}
+
+func compact() interface{} {
+	v := os.Getenv("COMPACT")
+	if len(v) > 0 {
+		return v
+	}
+	compact := flags["compact"].(*string)
+	if compact != nil {
+		return *compact
+	}
+	return ""
+}
+
+func diskQuota() interface{} {
+	v := os.Getenv("DISK_QUOTA")
+	if len(v) > 0 {
+		return v
+	}
+	quota := flags["disk-quota"].(*string)
+	if quota != nil {
+		return *quota
+	}
+	return ""
+}
+
+func insecure() interface{} {
+	v := os.Getenv("INSECURE")
+	if len(v) > 0 {
+		return strings.ToLower(v) == "true"
+	}
+	insecure := flags["insecure"].(*bool)
+	if insecure != nil {
+		return *insecure
+	}
+	return false
+}
+
+func proxy() interface{} {
+	v := os.Getenv("PROXY")
+	if len(v) > 0 {
+		return v
+	}
+	proxy := flags["proxy"].(*string)
+	if proxy != nil {
+		return *proxy
+	}
+	return ""
+}
+
+func httpTimeout() interface{} {
+	v := os.Getenv("HTTP_TIMEOUT")
+	if len(v) > 0 {
+		timeout, err := time.ParseDuration(v)
+		if err == nil {
+			return timeout
+		}
+	}
+	timeout := flags["http-timeout"].(*time.Duration)
+	if timeout != nil {
+		return *timeout
+	}
+	return 5 * time.Minute
+}
+
+func preload() interface{} {
+	v := os.Getenv("PRELOAD")
+	if len(v) > 0 {
+		return v
+	}
+	preload := flags["preload"].(*string)
+	if preload != nil {
+		return *preload
+	}
+	return ""
+}
+
+func maxPreload() interface{} {
+	v := os.Getenv("MAX_PRELOAD")
+	if len(v) > 0 {
+		n, err := strconv.Atoi(v)
+		if err == nil {
+			return n
+		}
+	}
+	maxPreload := flags["max-preload"].(*int)
+	if maxPreload != nil {
+		return *maxPreload
+	}
+	return 1000
+}
+
+func adminToken() interface{} {
+	v := os.Getenv("ADMIN_TOKEN")
+	if len(v) > 0 {
+		return v
+	}
+	adminToken := flags["admin-token"].(*string)
+	if adminToken != nil {
+		return *adminToken
+	}
+	return ""
+}
+
+// admin checks bearer token of admin handler
+func admin(handler http.HandlerFunc) http.HandlerFunc {
+	token := "Bearer " + adminToken().(string)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(token)) != 1 {
+			http.Error(w, "invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// parseCompaction parses format and optional compression level (hgt.zst:19)
+func parseCompaction(s string) (srtm.TileFormat, int, error) {
+	parts := strings.SplitN(s, ":", 2)
+	format, err := srtm.ParseTileFormat(parts[0])
+	if err != nil {
+		return format, 0, err
+	}
+	if len(parts) == 1 {
+		return format, 0, nil
+	}
+	level, err := strconv.Atoi(parts[1])
+	return format, level, err
+}
+
+// startCompaction converts tile directory into format in background until cancel of ctx.
+// startCompaction returns false if compaction is already running
+func startCompaction(ctx context.Context, data *srtm.SRTM, format srtm.TileFormat, level int) bool {
+	if !atomic.CompareAndSwapInt32(&compacting, 0, 1) {
+		return false
+	}
+	compaction.Add(1)
+	go func() {
+		defer compaction.Done()
+		defer atomic.StoreInt32(&compacting, 0)
+		start := time.Now()
+		tiles, err := data.Compact(ctx, format, level)
+		if err != nil {
+			log.Error().Caller().Err(err).Msg("")
+			return
+		}
+		failed := 0
+		for _, t := range tiles {
+			if len(t.Error) > 0 {
+				failed++
+			}
+		}
+		log.Info().Caller().Str("format", string(format)).Int("level", level).Int("tiles", len(tiles)).Int("failed", failed).Dur("duration", time.Since(start)).Msg("compaction finished")
+	}()
+	return true
+}
+
+// parseBBoxes parses semicolon separated list of bboxes
+func parseBBoxes(s string) ([]srtm.BBox, error) {
+	bboxes := make([]srtm.BBox, 0)
+	for _, part := range strings.Split(s, ";") {
+		if len(strings.TrimSpace(part)) == 0 {
+			continue
+		}
+		bbox, err := srtm.ParseBBox(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		bboxes = append(bboxes, bbox)
+	}
+	return bboxes, nil
+}
+
+func download() interface{} {
+	v := os.Getenv("DOWNLOAD")
+	if len(v) > 0 {
+		return strings.ToLower(v) == "true"
+	}
+	download := flags["download"].(*bool)
+	if download != nil {
+		return *download
+	}
+	return true
+}
+
+func workers() interface{} {
+	v := os.Getenv("WORKERS")
+	if len(v) > 0 {
+		n, err := strconv.Atoi(v)
+		if err == nil {
+			return n
+		}
+	}
+	workers := flags["workers"].(*int)
+	if workers != nil {
+		return *workers
+	}
+	return runtime.NumCPU()
+}
+
 func httpPort() interface{} {
 	v := os.Getenv("HTTP_PORT")
 	if len(v) > 0 {
@@ -143,12 +498,17 @@ func init() {
 	flag.Parse()
 	fmt.Fprintf(os.Stderr, "\nRunning %s with args:\n", os.Args[0])
 	for k, v := range args {
+		if _, ok := secrets[k]; ok && len(fmt.Sprint(v())) > 0 {
+			fmt.Fprintf(os.Stderr, "  --%s=***\n", k)
+			continue
+		}
 		fmt.Fprintf(os.Stderr, "  --%s=%+v\n", k, v())
 	}
 	fmt.Fprintln(os.Stderr)
 }
 
 func main() {
+	zerolog.TimeFieldFormat = "2006.01.02-15:04:05.000"
 	l, err := zerolog.ParseLevel(logLevel().(string))
 	if err != nil {
 		log.Error().Caller().Err(err).Msg("")
@@ -158,16 +518,40 @@ func main() {
 		l = zerolog.DebugLevel
 	}
 	zerolog.SetGlobalLevel(l)
-	data, err := srtm.New(lruCacheSize().(int), tileDirectory().(string), expiration().(time.Duration))
+	opts, err := newConfig().options()
+	if err != nil {
+		log.Error().Caller().Err(err).Msg("")
+		return
+	}
+	m := newMetrics()
+	data, err := srtm.NewWithOptions(append(opts, srtm.WithObserver(m))...)
 	if err != nil {
 		log.Error().Caller().Err(err).Msg("")
 		return
 	}
 	defer data.Destroy()
-	pool := &sync.Pool{
-		New: func() interface{} {
-			return &geojson.Geometry{}
-		},
+	// ctx is canceled on shutdown of web-server
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.size = data.Size
+	bboxes, err := parseBBoxes(preload().(string))
+	if err != nil {
+		log.Error().Caller().Err(err).Msg("")
+		return
+	}
+	for _, bbox := range bboxes {
+		if _, err := data.Preload(ctx, bbox); err != nil {
+			log.Error().Caller().Err(err).Msg("")
+			return
+		}
+	}
+	if len(compact().(string)) > 0 {
+		format, level, err := parseCompaction(compact().(string))
+		if err != nil {
+			log.Error().Caller().Err(err).Msg("")
+			return
+		}
+		startCompaction(ctx, data, format, level)
 	}
 	router := mux.NewRouter().PathPrefix(www().(string)).Subrouter()
 	if debug().(bool) {
@@ -183,9 +567,30 @@ func main() {
 		router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 		router.HandleFunc("/debug/pprof/trace", pprof.Trace)
 	}
-	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		handleAddElevations(w, r, data, pool)
-	}).Methods(http.MethodPost)
+	router.HandleFunc("/", m.instrument("elevations", func(w http.ResponseWriter, r *http.Request) {
+		handleAddElevations(w, r, data)
+	})).Methods(http.MethodPost)
+	router.HandleFunc("/zonal-stats", m.instrument("zonal-stats", func(w http.ResponseWriter, r *http.Request) {
+		handleZonalStats(w, r, data)
+	})).Methods(http.MethodPost)
+	router.HandleFunc("/export", m.instrument("export", func(w http.ResponseWriter, r *http.Request) {
+		handleExport(w, r, data)
+	})).Methods(http.MethodGet)
+	router.HandleFunc("/metrics", m.handle).Methods(http.MethodGet)
+	router.HandleFunc("/coverage", m.instrument("coverage", func(w http.ResponseWriter, r *http.Request) {
+		handleCoverage(w, r, data)
+	})).Methods(http.MethodGet)
+	if len(adminToken().(string)) > 0 {
+		router.HandleFunc("/admin/preload", m.instrument("preload", admin(func(w http.ResponseWriter, r *http.Request) {
+			handlePreload(w, r, data)
+		}))).Methods(http.MethodPost)
+		router.HandleFunc("/admin/release", m.instrument("release", admin(func(w http.ResponseWriter, r *http.Request) {
+			handleRelease(w, r, data)
+		}))).Methods(http.MethodPost)
+		router.HandleFunc("/admin/compact", m.instrument("compact", admin(func(w http.ResponseWriter, r *http.Request) {
+			handleCompact(ctx, w, r, data)
+		}))).Methods(http.MethodPost)
+	}
 	if debug().(bool) {
 		go func() {
 			var memory runtime.MemStats
@@ -197,7 +602,7 @@ func main() {
 					Str("cache size", humanize.Bytes(data.Size())).
 					Str("stack", humanize.Bytes(memory.StackInuse)).
 					Str("heap", humanize.Bytes(memory.HeapAlloc)).
-					Str("total", humanize.Bytes(memory.StackInuse + memory.HeapAlloc)).
+					Str("total", humanize.Bytes(memory.StackInuse+memory.HeapAlloc)).
 					Str("sys", humanize.Bytes(memory.Sys)).
 					Uint32("num gc", memory.NumGC).
 					Msg("")
@@ -205,33 +610,306 @@ func main() {
 			}
 		}()
 	}
+	server := &http.Server{
+		Addr:    ":" + strconv.Itoa(httpPort().(int)),
+		Handler: cors.Default().Handler(router),
+	}
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		log.Info().Caller().Msg("shutdown web-server...")
+		cancel()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer shutdownCancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Error().Caller().Err(err).Msg("")
+		}
+	}()
 	log.Info().Caller().Int("http-port", httpPort().(int)).Msg("running web-server...")
-	if err := http.ListenAndServe(":"+strconv.Itoa(httpPort().(int)), cors.Default().Handler(router)); err != nil {
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Error().Caller().Err(err).Msg("")
 	}
+	// compaction is stopped before Destroy
+	cancel()
+	compaction.Wait()
 }
 
-func handleAddElevations(w http.ResponseWriter, r *http.Request, data *srtm.SRTM, pool *sync.Pool) {
+func handleAddElevations(w http.ResponseWriter, r *http.Request, data *srtm.SRTM) {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	geoJson := pool.Get().(*geojson.Geometry)
-	defer pool.Put(geoJson)
-	if err := geoJson.UnmarshalJSON(body); err != nil {
+	datum, err := srtm.ParseDatum(r.URL.Query().Get("datum"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if datum == srtm.DatumWGS84 && len(geoidFile().(string)) == 0 {
+		http.Error(w, srtm.ErrNoGeoid.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err = data.AddElevationsJSON(body, false, datum)
+	var errs srtm.PointErrors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			if errors.Is(e, srtm.ErrOutOfRange) {
+				http.Error(w, e.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		// coordinates without tiles keeps original 2D coordinate
+		log.Debug().Caller().Err(err).Msg("")
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if err := data.AddElevations(geoJson, true); err != nil {
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func checkArea(bbox srtm.BBox) error {
+	if area := bbox.Area(); area > exportMaxArea().(float64) {
+		return fmt.Errorf("bbox area %f is greater than %f square degrees", area, exportMaxArea().(float64))
+	}
+	return nil
+}
+
+// tileFeature returns polygon feature of tile with status property
+func tileFeature(key, status string) (*geojson.Feature, error) {
+	sw, err := srtm.ParseKey(key)
+	if err != nil {
+		return nil, err
+	}
+	f := geojson.NewPolygonFeature([][][]float64{{
+		{sw.Longitude, sw.Latitude},
+		{sw.Longitude + 1, sw.Latitude},
+		{sw.Longitude + 1, sw.Latitude + 1},
+		{sw.Longitude, sw.Latitude + 1},
+		{sw.Longitude, sw.Latitude},
+	}})
+	f.SetProperty("key", key)
+	f.SetProperty("status", status)
+	return f, nil
+}
+
+func handleCoverage(w http.ResponseWriter, r *http.Request, data *srtm.SRTM) {
+	bbox, err := srtm.ParseBBox(r.URL.Query().Get("bbox"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	coverage, err := data.Coverage(bbox)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	body, err = geoJson.MarshalJSON()
+	fc := geojson.NewFeatureCollection()
+	for _, t := range coverage.Tiles {
+		f, err := tileFeature(t.Key, "present")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		f.SetProperty("format", string(t.Format))
+		f.SetProperty("resolution", t.Resolution)
+		f.SetProperty("bytes", t.Bytes)
+		fc.AddFeature(f)
+	}
+	for _, status := range []struct {
+		name string
+		keys []string
+	}{{"missing", coverage.Missing}, {"bad", coverage.Bads}} {
+		for _, key := range status.keys {
+			f, err := tileFeature(key, status.name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			fc.AddFeature(f)
+		}
+	}
+	body, err := fc.MarshalJSON()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/geo+json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(body)
 }
+
+func handlePreload(w http.ResponseWriter, r *http.Request, data *srtm.SRTM) {
+	bboxes, err := parseBBoxes(strings.Join(r.URL.Query()["bbox"], ";"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(bboxes) == 0 {
+		http.Error(w, "bbox is required", http.StatusBadRequest)
+		return
+	}
+	for _, bbox := range bboxes {
+		if err := checkArea(bbox); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	keys := make([]string, 0)
+	for _, bbox := range bboxes {
+		pinned, err := data.Preload(r.Context(), bbox)
+		keys = append(keys, pinned...)
+		if errors.Is(err, srtm.ErrPreloadLimit) {
+			data.Release(keys)
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		} else if err != nil {
+			data.Release(keys)
+			http.Error(w, err.Error(), http.StatusRequestTimeout)
+			return
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"tiles": keys,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func handleRelease(w http.ResponseWriter, r *http.Request, data *srtm.SRTM) {
+	keys := r.URL.Query()["key"]
+	if len(keys) == 0 {
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return
+	}
+	for _, key := range keys {
+		if _, err := srtm.ParseKey(key); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	data.Release(keys)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleCompact(ctx context.Context, w http.ResponseWriter, r *http.Request, data *srtm.SRTM) {
+	format, err := srtm.ParseTileFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	level := 0
+	if v := r.URL.Query().Get("level"); len(v) > 0 {
+		if level, err = strconv.Atoi(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if !startCompaction(ctx, data, format, level) {
+		http.Error(w, "compaction is already running", http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func handleZonalStats(w http.ResponseWriter, r *http.Request, data *srtm.SRTM) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	polygon, err := geojson.UnmarshalGeometry(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bbox, err := srtm.ZonalBBox(polygon)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkArea(bbox); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stats, err := data.ZonalStats(polygon)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	body, err = json.Marshal(stats)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func handleExport(w http.ResponseWriter, r *http.Request, data *srtm.SRTM) {
+	bbox, err := srtm.ParseBBox(r.URL.Query().Get("bbox"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkArea(bbox); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, ok := export.ParseFormat(r.URL.Query().Get("format"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown format '%s' (supported tiff, asc, png)", r.URL.Query().Get("format")), http.StatusBadRequest)
+		return
+	}
+	grid, err := data.Window(bbox)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	var body bytes.Buffer
+	switch format {
+	case export.GeoTIFF:
+		w.Header().Set("Content-Type", "image/tiff")
+		w.Header().Set("Content-Disposition", "attachment; filename=srtm.tif")
+		err = export.WriteGeoTIFF(&body, grid)
+	case export.ASCIIGrid:
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Disposition", "attachment; filename=srtm.asc")
+		err = export.WriteASCIIGrid(&body, grid)
+	case export.PNG:
+		// png is useless without world file, so both files are packed into zip
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", "attachment; filename=srtm.zip")
+		err = func() error {
+			z := zip.NewWriter(&body)
+			f, err := z.Create("srtm.png")
+			if err != nil {
+				return err
+			}
+			if err := export.WritePNG(f, grid); err != nil {
+				return err
+			}
+			f, err = z.Create("srtm.pgw")
+			if err != nil {
+				return err
+			}
+			if err := export.WriteWorldFile(f, grid); err != nil {
+				return err
+			}
+			return z.Close()
+		}()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asmyasnikov/srtm"
+)
+
+// buckets are upper bounds of latency histograms in seconds
+var buckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(buckets))
+	}
+	for i, b := range buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// metrics collects metrics of srtm-service in Prometheus text format.
+// It implements srtm.Observer
+type metrics struct {
+	mtx         sync.Mutex
+	requests    map[string]uint64 // handler + code
+	latencies   map[string]*histogram
+	hits        uint64
+	misses      uint64
+	evictions   uint64
+	loads       map[srtm.TileFormat]uint64
+	bads        uint64
+	downloads   map[string]uint64 // result
+	downloading histogram
+	size        func() uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:  make(map[string]uint64),
+		latencies: make(map[string]*histogram),
+		loads:     make(map[srtm.TileFormat]uint64),
+		downloads: make(map[string]uint64),
+	}
+}
+
+func (m *metrics) CacheHit(string) {
+	m.mtx.Lock()
+	m.hits++
+	m.mtx.Unlock()
+}
+
+func (m *metrics) CacheMiss(string) {
+	m.mtx.Lock()
+	m.misses++
+	m.mtx.Unlock()
+}
+
+func (m *metrics) CacheEvict(string) {
+	m.mtx.Lock()
+	m.evictions++
+	m.mtx.Unlock()
+}
+
+func (m *metrics) TileLoad(_ string, format srtm.TileFormat, _ time.Duration) {
+	m.mtx.Lock()
+	m.loads[format]++
+	m.mtx.Unlock()
+}
+
+func (m *metrics) TileBad(string) {
+	m.mtx.Lock()
+	m.bads++
+	m.mtx.Unlock()
+}
+
+func (m *metrics) Download(_ string, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.mtx.Lock()
+	m.downloads[result]++
+	m.downloading.observe(duration.Seconds())
+	m.mtx.Unlock()
+}
+
+// statusWriter remembers status code of response
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// instrument wraps handler with counting of requests and latency
+func (m *metrics) instrument(handler string, f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		f(sw, r)
+		m.mtx.Lock()
+		defer m.mtx.Unlock()
+		m.requests[handler+"\x00"+strconv.Itoa(sw.code)]++
+		h, ok := m.latencies[handler]
+		if !ok {
+			h = &histogram{}
+			m.latencies[handler] = h
+		}
+		h.observe(time.Since(start).Seconds())
+	}
+}
+
+func writeHistogram(w io.Writer, name, labels string, h *histogram) {
+	sep := ""
+	if len(labels) > 0 {
+		sep = ","
+	}
+	for i, b := range buckets {
+		c := uint64(0)
+		if h.counts != nil {
+			c = h.counts[i]
+		}
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, strconv.FormatFloat(b, 'g', -1, 64), c)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	if len(labels) > 0 {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+func header(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// write writes all metrics in Prometheus text exposition format
+func (m *metrics) write(w io.Writer) {
+	var size uint64
+	if m.size != nil {
+		size = m.size()
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	header(w, "srtm_http_requests_total", "counter", "Total number of HTTP requests by handler and status code.")
+	for _, k := range sortedKeys(m.requests) {
+		parts := strings.SplitN(k, "\x00", 2)
+		fmt.Fprintf(w, "srtm_http_requests_total{handler=%q,code=%q} %d\n", parts[0], parts[1], m.requests[k])
+	}
+	header(w, "srtm_http_request_duration_seconds", "histogram", "Latency of HTTP requests by handler.")
+	handlers := make([]string, 0, len(m.latencies))
+	for h := range m.latencies {
+		handlers = append(handlers, h)
+	}
+	sort.Strings(handlers)
+	for _, h := range handlers {
+		writeHistogram(w, "srtm_http_request_duration_seconds", fmt.Sprintf("handler=%q", h), m.latencies[h])
+	}
+
+	header(w, "srtm_cache_hits_total", "counter", "Total number of tile cache hits.")
+	fmt.Fprintf(w, "srtm_cache_hits_total %d\n", m.hits)
+	header(w, "srtm_cache_misses_total", "counter", "Total number of tile cache misses.")
+	fmt.Fprintf(w, "srtm_cache_misses_total %d\n", m.misses)
+	header(w, "srtm_cache_evictions_total", "counter", "Total number of tiles evicted from cache.")
+	fmt.Fprintf(w, "srtm_cache_evictions_total %d\n", m.evictions)
+	header(w, "srtm_cache_size_bytes", "gauge", "Approximate memory size of cached tiles.")
+	fmt.Fprintf(w, "srtm_cache_size_bytes %d\n", size)
+
+	header(w, "srtm_tiles_loaded_total", "counter", "Total number of tiles loaded by file format.")
+	formats := make([]string, 0, len(m.loads))
+	for f := range m.loads {
+		formats = append(formats, string(f))
+	}
+	sort.Strings(formats)
+	for _, f := range formats {
+		fmt.Fprintf(w, "srtm_tiles_loaded_total{format=%q} %d\n", f, m.loads[srtm.TileFormat(f)])
+	}
+	header(w, "srtm_bad_tiles_total", "counter", "Total number of tiles marked as bad.")
+	fmt.Fprintf(w, "srtm_bad_tiles_total %d\n", m.bads)
+
+	header(w, "srtm_downloads_total", "counter", "Total number of tile download attempts by result.")
+	for _, r := range sortedKeys(m.downloads) {
+		fmt.Fprintf(w, "srtm_downloads_total{result=%q} %d\n", r, m.downloads[r])
+	}
+	header(w, "srtm_download_duration_seconds", "histogram", "Duration of tile download attempts.")
+	writeHistogram(w, "srtm_download_duration_seconds", "", &m.downloading)
+}
+
+func (m *metrics) handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
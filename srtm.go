@@ -1,89 +1,230 @@
 package srtm
 
 import (
-	"encoding/binary"
 	lru "github.com/hashicorp/golang-lru"
-	"github.com/rs/zerolog/log"
+	"os"
+	"path/filepath"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
-	"unsafe"
 )
 
 // SRTM is a struct contains all internal data
 type SRTM struct {
+	// counters are first for 64-bit alignment of atomic operations
+	hits          uint64
+	misses        uint64
+	evictions     uint64
+	loading       int64
 	cache         *lru.Cache
 	mtx           sync.Mutex
 	tileDirectory string
 	done          chan (struct{})
 	bads          []string
+	badsView      atomic.Value // copy of bads for lock-free Stats
+	resident      sync.Map     // key -> *Tile of cached tiles for lock-free Stats
+	geoid         atomic.Value
+	datum         int32
+	fill          atomic.Value
+	pool          *pool
+	pinned        map[string]*pin
+	loads         map[string]chan struct{} // key -> closed when loading of tile is done
+	preloaded     map[string]int           // key -> count of preloads of pinned tile
+	maxPreload    int
+	download      bool
+	downloader    *downloader
+	manifest      *manifest
+	offline       bool
+	fallback      *float64
+	diskQuota     int64
+	quotaPending  int32 // 1 when tile was loaded and disk quota is not checked
+	log           Logger
+	observer      Observer
+}
+
+// pin is a tile pinned in memory for the duration of bulk processing
+type pin struct {
+	tile *Tile
+	refs int
 }
 
 // New make initialization of cache
 func New(lruCacheSize int, tileDir string, expiration time.Duration) (*SRTM, error) {
-	log.Info().Caller().Int("LRU cache size", lruCacheSize).Str("tile dir", tileDir).Msg("")
-	cache, err := lru.NewWithEvict(lruCacheSize, func(key interface{}, value interface{}) {
-		log.Debug().Caller().Msgf("remove tile '%s' from cache", key.(string))
-		tile, ok := value.(*Tile)
-		if !ok {
-			log.Error().Caller().Msgf("cache value for key '%s' is not a tile (%+v)", key, value)
-			return
-		}
-		if tile.f != nil {
-			if err := tile.f.Close(); err != nil {
-				log.Error().Caller().Err(err).Msg("")
-			}
-		}
-		runtime.GC()
-	})
-	if err != nil {
-		log.Error().Caller().Err(err).Msg("")
-		return nil, err
+	return NewWithOptions(
+		WithLRUCacheSize(lruCacheSize),
+		WithTileDirectory(tileDir),
+		WithExpiration(expiration),
+	)
+}
+
+// NewWithOptions make initialization of cache with functional options
+func NewWithOptions(opts ...Option) (*SRTM, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
 	}
+	o.logger.Info("new srtm", "LRU cache size", o.lruCacheSize, "tile dir", o.tileDirectory, "download", o.download, "workers", o.workers)
 	srtm := &SRTM{
-		cache:         cache,
 		mtx:           sync.Mutex{},
-		tileDirectory: tileDir,
+		tileDirectory: o.tileDirectory,
 		done:          make(chan struct{}),
 		bads:          make([]string, 0),
+		datum:         int32(o.datum),
+		pinned:        make(map[string]*pin),
+		loads:         make(map[string]chan struct{}),
+		preloaded:     make(map[string]int),
+		maxPreload:    o.maxPreload,
+		download:      o.download,
+		offline:       o.offline,
+		fallback:      o.fallback,
+		diskQuota:     o.diskQuota,
+		log:           o.logger,
+		observer:      o.observer,
+	}
+	manifest, err := loadManifest(o.tileDirectory)
+	if err != nil {
+		o.logger.Error("load manifest", "error", err)
+	}
+	srtm.manifest = manifest
+	removed, err := removeStaleTemp(o.tileDirectory)
+	for _, path := range removed {
+		o.logger.Info("remove temporary file left by crashed process", "path", path)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		o.logger.Error("remove temporary files", "error", err)
+	}
+	srtm.downloader = newDownloader(o.httpClient, o.providers, manifest, o.downloadConcurrency, o.downloadRetries, o.maxDownloadSize, o.logger)
+	if o.geoid != nil {
+		srtm.geoid.Store(o.geoid)
 	}
-	if expiration > 0 {
-		go srtm.sanityCleanLoop(expiration)
+	if o.fill != nil {
+		srtm.fill.Store(*o.fill)
+	}
+	cache, err := lru.NewWithEvict(o.lruCacheSize, srtm.onEvict)
+	if err != nil {
+		o.logger.Error("create LRU cache", "error", err)
+		return nil, err
+	}
+	srtm.cache = cache
+	srtm.pool = newPool(o.workers)
+	if o.expiration > 0 {
+		go srtm.sanityCleanLoop(o.expiration)
 	}
 	return srtm, nil
 }
 
+// onEvict is called by cache under d.mtx lock
+func (d *SRTM) onEvict(key interface{}, value interface{}) {
+	d.log.Debug("remove tile from cache", "key", key)
+	atomic.AddUint64(&d.evictions, 1)
+	d.observer.CacheEvict(key.(string))
+	tile, ok := value.(*Tile)
+	if !ok {
+		d.resident.Delete(key)
+		d.log.Error("cache value is not a tile", "key", key, "value", value)
+		return
+	}
+	d.manifest.touch(filepath.Base(tile.path), tile.LRU())
+	if p, ok := d.pinned[key.(string)]; ok && p.tile == tile {
+		// pinned tile stays resident and will be closed on unpin
+		return
+	}
+	d.resident.Delete(key)
+	tile.close()
+	runtime.GC()
+}
+
+// pinTile loads tile and keeps it in memory until unpinTile
+func (d *SRTM) pinTile(ll LatLng) (*Tile, error) {
+	defer d.enforceDiskQuota()
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	tile, err := d.loadTileLocked(ll)
+	if err != nil {
+		return nil, err
+	}
+	key := tileKey(ll)
+	p, ok := d.pinned[key]
+	if !ok {
+		p = &pin{
+			tile: tile,
+		}
+		d.pinned[key] = p
+	}
+	p.refs++
+	return p.tile, nil
+}
+
+func (d *SRTM) unpinTile(ll LatLng) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.unpinKeyLocked(tileKey(ll))
+}
+
+// unpinKeyLocked decrements references of pinned tile and closes tile
+// evicted from cache while pinned. Caller must hold d.mtx
+func (d *SRTM) unpinKeyLocked(key string) {
+	p, ok := d.pinned[key]
+	if !ok {
+		return
+	}
+	p.refs--
+	if p.refs > 0 {
+		return
+	}
+	delete(d.pinned, key)
+	if t, ok := d.cache.Peek(key); !ok || t.(*Tile) != p.tile {
+		// tile was evicted from cache while pinned
+		d.resident.Delete(key)
+		p.tile.close()
+	}
+}
+
 // Destroy clean all internal data
 func (d *SRTM) Destroy() {
 	d.mtx.Lock()
 	d.cache.Purge()
 	close(d.done)
 	d.mtx.Unlock()
+	if err := d.manifest.flush(); err != nil {
+		d.log.Error("save manifest", "error", err)
+	}
+	d.pool.close()
+}
+
+// SetWorkers sets size of workers pool shared between all AddElevations calls
+// (runtime.NumCPU() by default)
+func (d *SRTM) SetWorkers(n int) {
+	d.pool.resize(n)
+}
+
+// SetGeoid sets geoid grid for conversion between orthometric and ellipsoidal heights
+func (d *SRTM) SetGeoid(geoid *Geoid) {
+	d.geoid.Store(geoid)
+}
+
+// SetDatum sets default vertical datum of elevations returned by AddElevation and AddElevations
+func (d *SRTM) SetDatum(datum Datum) {
+	atomic.StoreInt32(&d.datum, int32(datum))
+}
+
+func (d *SRTM) getGeoid() *Geoid {
+	geoid, _ := d.geoid.Load().(*Geoid)
+	return geoid
 }
 
+func (d *SRTM) getDatum() Datum {
+	return Datum(atomic.LoadInt32(&d.datum))
+}
+
+// Size returns approximate memory size of cached tiles
 func (d *SRTM) Size() uint64 {
-	d.mtx.Lock()
-	defer d.mtx.Unlock()
 	total := uint64(0)
-	for _, key := range d.cache.Keys() {
-		value, ok := d.cache.Get(key)
-		if !ok {
-			continue
-		}
-		tile, ok := value.(*Tile)
-		if !ok {
-			continue
-		}
-		total += uint64(unsafe.Sizeof(*tile))
-		total += uint64(unsafe.Sizeof(*tile.sw))
-		total += uint64(unsafe.Sizeof(tile.size))
-		if tile.f != nil {
-			total += uint64(unsafe.Sizeof(*tile.f))
-		}
-		if len(tile.elevations) > 0 {
-			total += uint64(binary.Size(tile.elevations))
-		}
-	}
+	d.resident.Range(func(_, value interface{}) bool {
+		total += value.(*Tile).memSize()
+		return true
+	})
 	return total
 }
 
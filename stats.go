@@ -0,0 +1,55 @@
+package srtm
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// TileStats contains statistics of tile resident in cache
+type TileStats struct {
+	Key        string     `json:"key"`
+	Format     TileFormat `json:"format"`
+	Bytes      uint64     `json:"bytes"`
+	LastAccess time.Time  `json:"lastAccess"`
+}
+
+// Stats contains statistics of tiles cache
+type Stats struct {
+	Hits      uint64      `json:"hits"`
+	Misses    uint64      `json:"misses"`
+	Evictions uint64      `json:"evictions"`
+	Loading   int64       `json:"loading"`
+	Tiles     []TileStats `json:"tiles"`
+	Bads      []string    `json:"bads"`
+}
+
+// Stats returns statistics of tiles cache. It does not take lock of cache,
+// so it is cheap and does not wait of loading tiles
+func (d *SRTM) Stats() Stats {
+	stats := Stats{
+		Hits:      atomic.LoadUint64(&d.hits),
+		Misses:    atomic.LoadUint64(&d.misses),
+		Evictions: atomic.LoadUint64(&d.evictions),
+		Loading:   atomic.LoadInt64(&d.loading),
+		Tiles:     make([]TileStats, 0),
+		Bads:      make([]string, 0),
+	}
+	d.resident.Range(func(key, value interface{}) bool {
+		tile := value.(*Tile)
+		stats.Tiles = append(stats.Tiles, TileStats{
+			Key:        key.(string),
+			Format:     tile.format,
+			Bytes:      tile.memSize(),
+			LastAccess: tile.LRU(),
+		})
+		return true
+	})
+	sort.Slice(stats.Tiles, func(i, j int) bool {
+		return stats.Tiles[i].Key < stats.Tiles[j].Key
+	})
+	if bads, ok := d.badsView.Load().([]string); ok {
+		stats.Bads = append(stats.Bads, bads...)
+	}
+	return stats
+}
@@ -0,0 +1,37 @@
+package srtm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTile(t, dir, "N10E010", 100)
+	writeTestTile(t, dir, "N11E010", 200)
+	data, err := NewWithOptions(
+		WithTileDirectory(dir),
+		WithLRUCacheSize(1),
+		WithExpiration(-1),
+		WithDownload(false),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	start := time.Now()
+	for _, point := range [][]float64{{10.5, 10.5}, {10.5, 10.5}, {10.5, 11.5}, {20.5, 20.5}} {
+		_, _ = data.AddElevation(point)
+	}
+	stats := data.Stats()
+	require.Equal(t, uint64(1), stats.Hits)
+	require.Equal(t, uint64(3), stats.Misses)
+	require.Equal(t, uint64(1), stats.Evictions)
+	require.Equal(t, int64(0), stats.Loading)
+	require.Equal(t, []string{"N20E020"}, stats.Bads)
+	require.Equal(t, 1, len(stats.Tiles))
+	require.Equal(t, "N11E010", stats.Tiles[0].Key)
+	require.Equal(t, FormatHGT, stats.Tiles[0].Format)
+	require.False(t, stats.Tiles[0].LastAccess.Before(start))
+	require.Equal(t, data.Size(), stats.Tiles[0].Bytes)
+}
@@ -3,17 +3,33 @@ package srtm
 import (
 	"encoding/binary"
 	"fmt"
-	"github.com/rs/zerolog/log"
+	"github.com/pkg/errors"
 	"math"
 	"os"
 	"path"
+	"path/filepath"
 	"sort"
-	"strings"
 	"sync/atomic"
+	"syscall"
 	"time"
+	"unsafe"
 )
 
+// tileSouthWest returns south-west corner of tile contains location.
+// Locations on north pole belongs to the edge tile of 89 latitude
+func tileSouthWest(ll LatLng) LatLng {
+	sw := LatLng{
+		Latitude:  math.Floor(ll.Latitude),
+		Longitude: math.Floor(ll.Longitude),
+	}
+	if sw.Latitude >= 90 {
+		sw.Latitude = 89
+	}
+	return sw
+}
+
 func tileKey(ll LatLng) string {
+	ll = tileSouthWest(ll)
 	return fmt.Sprintf("%s%02d%s%03d",
 		func() string {
 			if ll.Latitude < 0 {
@@ -32,58 +48,196 @@ func tileKey(ll LatLng) string {
 	)
 }
 
+// ParseKey returns south-west corner of tile by key (for example N45E006)
+func ParseKey(key string) (LatLng, error) {
+	if len(key) != 7 {
+		return LatLng{}, errors.Wrapf(ErrInvalidHGTFileName, "key '%s'", key)
+	}
+	sw, err := southWest(key + ".hgt")
+	if err != nil {
+		return LatLng{}, errors.Wrapf(err, "key '%s'", key)
+	}
+	return *sw, nil
+}
+
+// ErrTileNotFound is returned when tile file is missing in tile directory
+// (and can not be downloaded)
+var ErrTileNotFound = errors.New("tile not found")
+
 var suffixes = []string{
 	"",
 	".hgt",
-	".gz",
+	".hgt.gz",
+	".hgt.zst",
+	".hgt.blk",
 }
 
-func tilePath(tileDir string, ll LatLng) (string, os.FileInfo, error) {
-	key := tileKey(ll)
-	tilePath := path.Join(tileDir, key)
+// findTile returns path of existing tile file
+func findTile(tileDir string, ll LatLng) (string, os.FileInfo, error) {
+	return findKey(tileDir, tileKey(ll))
+}
+
+// findKey returns path of existing tile file by key of tile
+func findKey(tileDir, key string) (string, os.FileInfo, error) {
 	for _, s := range suffixes {
-		tilePath = tilePath + s
+		tilePath := path.Join(tileDir, key+s)
 		info, err := os.Stat(tilePath)
 		if err == nil || os.IsExist(err) {
 			return tilePath, info, nil
 		}
 	}
-	return download(tileDir, ll)
+	return "", nil, errors.Wrapf(ErrTileNotFound, "tile file for key = %s is not exists in %s", key, tileDir)
 }
 
 func (d *SRTM) loadTile(ll LatLng) (*Tile, error) {
+	d.mtx.Lock()
+	tile, err := d.loadTileLocked(ll)
+	d.mtx.Unlock()
+	d.enforceDiskQuota()
+	return tile, err
+}
+
+// loadTileLocked loads tile into cache. Caller must hold d.mtx. d.mtx is released
+// while tile is opened (downloaded), concurrent loads of the same tile wait for it
+func (d *SRTM) loadTileLocked(ll LatLng) (*Tile, error) {
 	key := tileKey(ll)
+	for {
+		if i := sort.SearchStrings(d.bads, key); i < len(d.bads) && d.bads[i] == key {
+			return nil, errors.Wrapf(ErrTileNotFound, "tile for key '%s' marked as bad", key)
+		}
+		if p, ok := d.pinned[key]; ok {
+			atomic.AddUint64(&d.hits, 1)
+			d.observer.CacheHit(key)
+			return p.tile, nil
+		}
+		t, ok := d.cache.Get(key)
+		if ok {
+			atomic.AddUint64(&d.hits, 1)
+			d.observer.CacheHit(key)
+			return t.(*Tile), nil
+		}
+		wait, ok := d.loads[key]
+		if !ok {
+			break
+		}
+		d.mtx.Unlock()
+		<-wait
+		d.mtx.Lock()
+	}
+	atomic.AddUint64(&d.misses, 1)
+	d.observer.CacheMiss(key)
+	atomic.AddInt64(&d.loading, 1)
+	defer atomic.AddInt64(&d.loading, -1)
+	wait := make(chan struct{})
+	d.loads[key] = wait
+	defer func() {
+		delete(d.loads, key)
+		close(wait)
+	}()
+	d.mtx.Unlock()
+	tile, err := d.openTile(ll)
+	if errors.Is(err, ErrCorruptTile) && d.canDownload() {
+		// corrupt tile is quarantined, so it will be downloaded again
+		tile, err = d.openTile(ll)
+	}
 	d.mtx.Lock()
-	defer d.mtx.Unlock()
-	if sort.SearchStrings(d.bads, key) < len(d.bads) {
-		return nil, fmt.Errorf("tile for key '%s' marked as bad", key)
+	if err != nil {
+		if errors.Is(err, ErrTileNotFound) && !d.offline {
+			d.markBad(key)
+			d.observer.TileBad(key)
+		}
+		return nil, err
 	}
-	t, ok := d.cache.Get(key)
-	if ok {
-		return t.(*Tile), nil
+	d.addTile(key, tile)
+	if d.diskQuota > 0 {
+		// disk quota is enforced by caller after release of d.mtx
+		atomic.StoreInt32(&d.quotaPending, 1)
+	}
+	return tile, nil
+}
+
+func (d *SRTM) canDownload() bool {
+	return d.download && !d.offline
+}
+
+// openTile finds (or downloads) and opens tile file. Corrupt tile file is quarantined
+func (d *SRTM) openTile(ll LatLng) (*Tile, error) {
+	key := tileKey(ll)
+	start := time.Now()
+	tPath, info, err := findTile(d.tileDirectory, ll)
+	if err != nil && d.canDownload() {
+		tPath, info, err = d.downloader.download(d.tileDirectory, ll)
+		d.observer.Download(key, time.Since(start), err)
+		start = time.Now()
 	}
-	tPath, info, err := tilePath(d.tileDirectory, ll)
 	if err != nil {
-		d.bads = append(d.bads, key)
-		sort.Strings(d.bads)
 		return nil, err
 	}
-	if strings.HasSuffix(tPath, ".gz") {
-		sw, size, elevations, err := ReadFile(tPath)
+	tile, err := d.readTile(tPath, info)
+	if errors.Is(err, ErrCorruptTile) {
+		dest, qerr := d.manifest.quarantine(tPath)
+		if qerr != nil {
+			d.log.Error("quarantine corrupt tile", "tile path", tPath, "error", qerr)
+		} else {
+			d.log.Warn("quarantine corrupt tile", "tile path", tPath, "quarantine path", dest, "error", err)
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.observer.TileLoad(key, tile.format, time.Since(start))
+	return tile, nil
+}
+
+// readTile verifies tile file and reads gzipped tile into memory or opens raw tile
+// for lazy reading
+func (d *SRTM) readTile(tPath string, info os.FileInfo) (*Tile, error) {
+	if err := d.manifest.verify(tPath, info, false); err != nil {
+		return nil, err
+	}
+	format := tileFormat(tPath)
+	if format == FormatHGTBlock {
+		file, err := os.Open(tPath)
+		if err != nil {
+			return nil, err
+		}
+		blocks, err := openBlockTile(file, info.Size())
 		if err != nil {
+			file.Close()
+			return nil, corrupt(tPath, err)
+		}
+		sw, err := southWest(tPath)
+		if err != nil {
+			file.Close()
 			return nil, err
 		}
-		t = &Tile{
+		d.log.Debug("lazy load block tile", "tile path", tPath)
+		return &Tile{
+			f:      file,
+			path:   tPath,
+			sw:     sw,
+			size:   blocks.size,
+			blocks: blocks,
+			format: format,
+			log:    d.log,
+		}, nil
+	}
+	if format.compressed() {
+		sw, size, elevations, err := ReadFile(tPath)
+		if err != nil {
+			return nil, corrupt(tPath, err)
+		}
+		d.log.Debug("load tile to memory", "tile path", tPath)
+		return &Tile{
 			f:          nil,
+			path:       tPath,
 			sw:         sw,
 			size:       size,
 			elevations: elevations,
-		}
-		if evicted := d.cache.Add(key, t); evicted {
-			log.Debug().Caller().Err(err).Msgf("add tile '%s' to cache with evict oldest", key)
-		}
-		log.Debug().Caller().Str("tile path", tPath).Msg("load tile to memory")
-		return t.(*Tile), nil
+			format:     format,
+			log:        d.log,
+		}, nil
 	}
 	sw, size, err := Meta(tPath, info.Size())
 	if err != nil {
@@ -93,33 +247,95 @@ func (d *SRTM) loadTile(ll LatLng) (*Tile, error) {
 	if err != nil {
 		return nil, err
 	}
-	t = &Tile{
+	d.log.Debug("lazy load tile", "tile path", tPath)
+	return &Tile{
 		f:          file,
+		path:       tPath,
 		sw:         sw,
 		size:       size,
 		elevations: nil,
+		format:     format,
+		log:        d.log,
+	}, nil
+}
+
+// corrupt wraps error of decoding of tile file as ErrCorruptTile. Errors of file
+// system (too many open files, permission denied) are returned as is, so readable
+// tiles are not quarantined because of them
+func corrupt(path string, err error) error {
+	var pathErr *os.PathError
+	var errno syscall.Errno
+	if errors.As(err, &pathErr) || errors.As(err, &errno) {
+		return err
 	}
+	return errors.Wrapf(ErrCorruptTile, "%s: %s", path, err.Error())
+}
+
+// addTile adds tile to cache. Caller must hold d.mtx
+func (d *SRTM) addTile(key string, t *Tile) {
+	now := time.Now()
+	t.setLRU(now)
+	d.manifest.touch(filepath.Base(t.path), now)
+	// resident tile must be stored before eviction of another one
+	d.resident.Store(key, t)
 	if evicted := d.cache.Add(key, t); evicted {
-		log.Debug().Caller().Err(err).Msgf("add tile '%s' to cache with evict oldest", key)
+		d.log.Debug("add tile to cache with evict oldest", "key", key)
 	}
-	log.Debug().Caller().Str("tile path", tPath).Msg("lazy load tile")
-	return t.(*Tile), nil
+}
+
+// markBad marks tile as bad. Caller must hold d.mtx
+func (d *SRTM) markBad(key string) {
+	bads := make([]string, len(d.bads), len(d.bads)+1)
+	copy(bads, d.bads)
+	bads = append(bads, key)
+	sort.Strings(bads)
+	d.bads = bads
+	d.badsView.Store(bads)
 }
 
 // Tile struct contains hgt-tile meta-data and raw elevations slice
 type Tile struct {
-	f            *os.File
-	sw           *LatLng
-	size         int
-	elevations   []int16
+	f           *os.File
+	path        string
+	sw          *LatLng
+	size        int
+	elevations  []int16
+	blocks      *blockTile
 	internalLRU int64
+	format      TileFormat
+	log         Logger
+}
+
+// memSize returns approximate memory size of tile
+func (t *Tile) memSize() uint64 {
+	total := uint64(unsafe.Sizeof(*t))
+	total += uint64(unsafe.Sizeof(*t.sw))
+	if t.f != nil {
+		total += uint64(unsafe.Sizeof(*t.f))
+	}
+	if len(t.elevations) > 0 {
+		total += uint64(binary.Size(t.elevations))
+	}
+	if t.blocks != nil {
+		total += t.blocks.memSize()
+	}
+	return total
+}
+
+func (t *Tile) close() {
+	if t.f == nil {
+		return
+	}
+	if err := t.f.Close(); err != nil {
+		t.log.Error("close tile file", "error", err)
+	}
 }
 
 func (t *Tile) setLRU(lru time.Time) {
 	atomic.StoreInt64(&t.internalLRU, lru.UnixNano())
 }
 
-func (t *Tile) LRU() time.Time{
+func (t *Tile) LRU() time.Time {
 	u := atomic.LoadInt64(&t.internalLRU)
 	return time.Unix(u/1e9, u%1e9)
 }
@@ -130,7 +346,7 @@ func (t *Tile) GetElevation(ll LatLng) (float64, error) {
 	row := (ll.Latitude - t.sw.Latitude) * size
 	col := (ll.Longitude - t.sw.Longitude) * size
 	if row < 0 || col < 0 || row > size || col > size {
-		return 0, fmt.Errorf("lat/lng is outside tile bounds (row=%f, col=%f, size=%f)", row, col, size)
+		return 0, errors.Wrapf(ErrOutOfRange, "lat/lng %s is outside tile bounds (row=%f, col=%f, size=%f)", ll.String(), row, col, size)
 	}
 	return t.interpolate(row, col), nil
 }
@@ -141,17 +357,20 @@ func avg(v1, v2, f float64) float64 {
 
 func (t *Tile) normalize(v, max int, description string) int {
 	if v < 0 {
-		log.Error().Caller().Msgf("normalize: error value %d of %s", v, description)
+		t.log.Error("normalize: error value", "value", v, "description", description)
 		return 0
 	}
 	if v > max {
-		log.Error().Caller().Msgf("normalize: error value %d of %s", v, description)
+		t.log.Error("normalize: error value", "value", v, "description", description)
 		return max
 	}
 	return v
 }
 
 func (t *Tile) elevation(idx int) (int16, error) {
+	if t.blocks != nil {
+		return t.blocks.elevation(idx)
+	}
 	b := make([]byte, 2)
 	n, err := t.f.ReadAt(b, int64(idx)*2)
 	if err != nil {
@@ -163,29 +382,38 @@ func (t *Tile) elevation(idx int) (int16, error) {
 	return int16(binary.BigEndian.Uint16(b)), nil
 }
 
+// value returns elevation of node in row (from south) and column (from west)
+func (t *Tile) value(row, col int) (int16, error) {
+	idx := (t.size-row-1)*t.size + col
+	if t.elevations != nil {
+		return t.elevations[idx], nil
+	}
+	return t.elevation(idx)
+}
+
 func (t *Tile) quadRowCol(row1, col1, row2, col2, row3, col3, row4, col4 int) (int16, int16, int16, int16) {
-	idx1 := (t.size-t.normalize(row1, (t.size-1), "row idx1")-1)*t.size + t.normalize(col1, t.size, "col idx1")
-	idx2 := (t.size-t.normalize(row2, (t.size-1), "row idx2")-1)*t.size + t.normalize(col2, t.size, "col idx2")
-	idx3 := (t.size-t.normalize(row3, (t.size-1), "row idx3")-1)*t.size + t.normalize(col3, t.size, "col idx3")
-	idx4 := (t.size-t.normalize(row4, (t.size-1), "row idx4")-1)*t.size + t.normalize(col4, t.size, "col idx4")
+	idx1 := (t.size-t.normalize(row1, (t.size-1), "row idx1")-1)*t.size + t.normalize(col1, (t.size-1), "col idx1")
+	idx2 := (t.size-t.normalize(row2, (t.size-1), "row idx2")-1)*t.size + t.normalize(col2, (t.size-1), "col idx2")
+	idx3 := (t.size-t.normalize(row3, (t.size-1), "row idx3")-1)*t.size + t.normalize(col3, (t.size-1), "col idx3")
+	idx4 := (t.size-t.normalize(row4, (t.size-1), "row idx4")-1)*t.size + t.normalize(col4, (t.size-1), "col idx4")
 	if t.elevations != nil {
 		return t.elevations[idx1], t.elevations[idx2], t.elevations[idx3], t.elevations[idx4]
 	}
 	e1, err := t.elevation(idx1)
 	if err != nil {
-		log.Error().Caller().Err(err).Int("row", row1).Int("col", col1).Int("idx", idx1).Msg("")
+		t.log.Error("read elevation", "row", row1, "col", col1, "idx", idx1, "error", err)
 	}
 	e2, err := t.elevation(idx2)
 	if err != nil {
-		log.Error().Caller().Err(err).Int("row", row2).Int("col", col2).Int("idx", idx2).Msg("")
+		t.log.Error("read elevation", "row", row2, "col", col2, "idx", idx2, "error", err)
 	}
 	e3, err := t.elevation(idx3)
 	if err != nil {
-		log.Error().Caller().Err(err).Int("row", row3).Int("col", col3).Int("idx", idx3).Msg("")
+		t.log.Error("read elevation", "row", row3, "col", col3, "idx", idx3, "error", err)
 	}
 	e4, err := t.elevation(idx4)
 	if err != nil {
-		log.Error().Caller().Err(err).Int("row", row4).Int("col", col4).Int("idx", idx4).Msg("")
+		t.log.Error("read elevation", "row", row4, "col", col4, "idx", idx4, "error", err)
 	}
 	return e1, e2, e3, e4
 }
@@ -197,6 +425,13 @@ func (t *Tile) interpolate(row, col float64) float64 {
 	colLow := int(math.Floor(col))
 	colHi := colLow + 1
 	colFrac := col - float64(colLow)
+	// locations on north and east edges of tile
+	if rowHi > t.size-1 {
+		rowHi = t.size - 1
+	}
+	if colHi > t.size-1 {
+		colHi = t.size - 1
+	}
 	v00, v10, v11, v01 := t.quadRowCol(rowLow, colLow, rowLow, colHi, rowHi, colHi, rowHi, colLow)
 	v1 := avg(float64(v00), float64(v10), colFrac)
 	v2 := avg(float64(v01), float64(v11), colFrac)
@@ -1,8 +1,13 @@
 package srtm
 
 import (
+	"encoding/binary"
+	"errors"
+	geojson "github.com/paulmach/go.geojson"
 	"github.com/stretchr/testify/require"
+	"io/ioutil"
 	"math"
+	"path"
 	"testing"
 )
 
@@ -29,3 +34,104 @@ func TestGetElevation(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, 25, int(math.Round(e)))
 }
+
+// writeTestTile writes 3 arcseconds hgt-tile filled with value
+func writeTestTile(t testing.TB, dir string, key string, value int16) string {
+	b := make([]byte, 1201*1201*2)
+	for i := 0; i < len(b); i += 2 {
+		binary.BigEndian.PutUint16(b[i:], uint16(value))
+	}
+	file := path.Join(dir, key+".hgt")
+	require.NoError(t, ioutil.WriteFile(file, b, 0644))
+	return file
+}
+
+func TestPinTile(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTile(t, dir, "N00E000", 100)
+	writeTestTile(t, dir, "N00E001", 200)
+	data, err := New(1, dir, -1)
+	require.NoError(t, err)
+	defer data.Destroy()
+	a := LatLng{Latitude: 0.5, Longitude: 0.5}
+	b := LatLng{Latitude: 0.5, Longitude: 1.5}
+	tile, err := data.pinTile(a)
+	require.NoError(t, err)
+	// evicts pinned tile from cache
+	_, err = data.loadTile(b)
+	require.NoError(t, err)
+	// evicted pinned tile is still resident
+	require.Equal(t, 2, len(data.Stats().Tiles))
+	e, err := tile.GetElevation(a)
+	require.NoError(t, err)
+	require.Equal(t, 100., e)
+	same, err := data.loadTile(a)
+	require.NoError(t, err)
+	require.True(t, same == tile)
+	data.unpinTile(a)
+	require.Equal(t, 0, len(data.pinned))
+	require.Equal(t, 1, len(data.Stats().Tiles))
+	// tile evicted while pinned is closed on unpin
+	_, err = tile.value(0, 0)
+	require.Error(t, err)
+}
+
+func TestAddElevations_TileLocality(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTile(t, dir, "N00E000", 100)
+	writeTestTile(t, dir, "N00E001", 200)
+	data, err := New(1, dir, -1)
+	require.NoError(t, err)
+	defer data.Destroy()
+	coordinates := make([][]float64, 0, 200)
+	for i := 0; i < 100; i++ {
+		coordinates = append(coordinates, []float64{0.5, 0.5}, []float64{1.5, 0.5})
+	}
+	lineString := geojson.NewLineStringGeometry(coordinates)
+	require.NoError(t, data.AddElevations(lineString, false))
+	for i, point := range lineString.LineString {
+		require.Equal(t, float64(100*(1+i%2)), point[2])
+	}
+	require.Equal(t, 0, len(data.pinned))
+}
+
+func TestGetElevation_TileEdges(t *testing.T) {
+	data, err := New(1, "testdata", -1)
+	require.NoError(t, err)
+	defer data.Destroy()
+	tile, err := data.loadTile(LatLng{Latitude: -45.5, Longitude: -65.5})
+	require.NoError(t, err)
+	for _, ll := range []LatLng{
+		{Latitude: -46, Longitude: -65},
+		{Latitude: -45, Longitude: -65},
+		{Latitude: -45, Longitude: -66},
+		{Latitude: -46, Longitude: -66},
+	} {
+		_, err := tile.GetElevation(ll)
+		require.NoError(t, err, ll.String())
+	}
+	_, err = tile.GetElevation(LatLng{Latitude: -44.9, Longitude: -65.5})
+	require.True(t, errors.Is(err, ErrOutOfRange))
+}
+
+func TestAddElevation_PoleAndAntimeridian(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTile(t, dir, "N89E000", 100)
+	writeTestTile(t, dir, "N10W180", 200)
+	data, err := New(2, dir, -1)
+	require.NoError(t, err)
+	defer data.Destroy()
+	point, err := data.AddElevation([]float64{0.5, 90})
+	require.NoError(t, err)
+	require.Equal(t, []float64{0.5, 90, 100}, point)
+	point, err = data.AddElevation([]float64{180, 10.5})
+	require.NoError(t, err)
+	require.Equal(t, []float64{180, 10.5, 200}, point)
+	point, err = data.AddElevation([]float64{-540, 10.5})
+	require.NoError(t, err)
+	require.Equal(t, []float64{-540, 10.5, 200}, point)
+	_, err = data.AddElevation([]float64{0, math.NaN()})
+	require.True(t, errors.Is(err, ErrOutOfRange))
+	_, err = data.AddElevation([]float64{0, 91})
+	require.True(t, errors.Is(err, ErrOutOfRange))
+}
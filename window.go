@@ -0,0 +1,182 @@
+package srtm
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Void is a value of hgt-tile cells without elevation data
+const Void int16 = -32768
+
+// Grid is a regular raster of elevations read from mosaic of hgt-tiles.
+// Nodes of grid are aligned with nodes (postings) of hgt-tiles
+type Grid struct {
+	// NorthWest is a location of the first (top left) node of grid
+	NorthWest LatLng
+	// CellSize is a distance between neighbour nodes in degrees
+	CellSize float64
+	Cols     int
+	Rows     int
+	// Elevations contains Rows*Cols values in row-major order from north to south
+	// and from west to east. Nodes without data contains Void
+	Elevations []int16
+	// Filled marks nodes of missing tiles which contain fallback elevation or
+	// fill value instead of data (nil if there are no such nodes)
+	Filled []bool
+}
+
+// At returns elevation of node in row (from north) and column (from west)
+func (g *Grid) At(row, col int) int16 {
+	return g.Elevations[row*g.Cols+col]
+}
+
+// BBox returns bounding box of grid nodes
+func (g *Grid) BBox() BBox {
+	return BBox{
+		SouthWest: LatLng{
+			Latitude:  g.NorthWest.Latitude - float64(g.Rows-1)*g.CellSize,
+			Longitude: g.NorthWest.Longitude,
+		},
+		NorthEast: LatLng{
+			Latitude:  g.NorthWest.Latitude,
+			Longitude: g.NorthWest.Longitude + float64(g.Cols-1)*g.CellSize,
+		},
+	}
+}
+
+// fill sets value of all nodes of tile with south-west corner ll and marks them as filled
+func (g *Grid) fill(lats, lngs gridAxis, ll LatLng, value int16) {
+	if g.Filled == nil {
+		g.Filled = make([]bool, len(g.Elevations))
+	}
+	for i := range lats.tiles {
+		if float64(lats.tiles[i]) != ll.Latitude {
+			continue
+		}
+		row := g.Rows - 1 - i
+		for j := range lngs.tiles {
+			if float64(lngs.tiles[j]) == ll.Longitude {
+				g.Elevations[row*g.Cols+j] = value
+				g.Filled[row*g.Cols+j] = true
+			}
+		}
+	}
+}
+
+// gridAxis maps global node indexes of one axis to tiles and offsets inside tiles
+type gridAxis struct {
+	first   int
+	tiles   []int
+	offsets []int
+}
+
+func newGridAxis(min, max float64, n int) gridAxis {
+	first := int(math.Ceil(min*float64(n) - 1e-6))
+	last := int(math.Floor(max*float64(n) + 1e-6))
+	axis := gridAxis{
+		first:   first,
+		tiles:   make([]int, 0, last-first+1),
+		offsets: make([]int, 0, last-first+1),
+	}
+	for k := first; k <= last; k++ {
+		tile := int(math.Floor(float64(k) / float64(n)))
+		offset := k - tile*n
+		// node on the north (east) edge of window belongs to the tile below (left)
+		if offset == 0 && k == last && k != first {
+			tile--
+			offset = n
+		}
+		axis.tiles = append(axis.tiles, tile)
+		axis.offsets = append(axis.offsets, offset)
+	}
+	return axis
+}
+
+// windowTileN is a number of grid cells per degree of window without tiles
+// (3 arc seconds)
+const windowTileN = 1200
+
+// Window reads elevations of bounding box area into a grid.
+// Resolution of grid is the finest resolution of tiles inside bounding box.
+// Nodes of missing tiles contain fallback elevation (see WithFallbackElevation)
+// or fill value (see WithFillValue) if one of them is set, otherwise Void
+func (d *SRTM) Window(bbox BBox) (*Grid, error) {
+	fill, withFill := d.fill.Load().(float64)
+	n := 0
+	tiles := bbox.tiles()
+	for _, ll := range tiles {
+		tile, err := d.loadTile(ll)
+		if err != nil {
+			d.log.Error("loadTile", "latLng", ll.String(), "error", err)
+			continue
+		}
+		if tile.size-1 > n {
+			n = tile.size - 1
+		}
+	}
+	if n == 0 {
+		if d.fallback == nil && !withFill {
+			return nil, fmt.Errorf("no tiles found for bbox %s", bbox.String())
+		}
+		n = windowTileN
+	}
+	lats := newGridAxis(bbox.SouthWest.Latitude, bbox.NorthEast.Latitude, n)
+	lngs := newGridAxis(bbox.SouthWest.Longitude, bbox.NorthEast.Longitude, n)
+	if len(lats.tiles) == 0 || len(lngs.tiles) == 0 {
+		return nil, fmt.Errorf("bbox %s does not contain grid nodes", bbox.String())
+	}
+	g := &Grid{
+		NorthWest: LatLng{
+			Latitude:  float64(lats.first+len(lats.tiles)-1) / float64(n),
+			Longitude: float64(lngs.first) / float64(n),
+		},
+		CellSize:   1 / float64(n),
+		Rows:       len(lats.tiles),
+		Cols:       len(lngs.tiles),
+		Elevations: make([]int16, len(lats.tiles)*len(lngs.tiles)),
+	}
+	for i := range g.Elevations {
+		g.Elevations[i] = Void
+	}
+	for _, ll := range tiles {
+		tile, err := d.pinTile(ll)
+		if err != nil {
+			switch {
+			case d.fallback != nil && errors.Is(err, ErrTileNotFound):
+				g.fill(lats, lngs, ll, int16(math.Round(*d.fallback)))
+			case withFill:
+				g.fill(lats, lngs, ll, int16(math.Round(fill)))
+			}
+			continue
+		}
+		tile.setLRU(time.Now())
+		tileN := tile.size - 1
+		for i := range lats.tiles {
+			if float64(lats.tiles[i]) != ll.Latitude {
+				continue
+			}
+			row := g.Rows - 1 - i
+			for j := range lngs.tiles {
+				if float64(lngs.tiles[j]) != ll.Longitude {
+					continue
+				}
+				r, c := lats.offsets[i]*tileN, lngs.offsets[j]*tileN
+				if r%n == 0 && c%n == 0 {
+					v, err := tile.value(r/n, c/n)
+					if err != nil {
+						d.log.Error("read tile value", "key", tileKey(ll), "row", r/n, "col", c/n, "error", err)
+						continue
+					}
+					g.Elevations[row*g.Cols+j] = v
+					continue
+				}
+				g.Elevations[row*g.Cols+j] = int16(math.Round(tile.interpolate(float64(r)/float64(n), float64(c)/float64(n))))
+			}
+		}
+		d.unpinTile(ll)
+	}
+	return g, nil
+}
@@ -0,0 +1,97 @@
+package srtm
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindow(t *testing.T) {
+	data, err := New(1, "testdata", -1)
+	require.NoError(t, err)
+	defer data.Destroy()
+	bbox, err := ParseBBox("-65.5,-45.5,-65.49,-45.495")
+	require.NoError(t, err)
+	g, err := data.Window(bbox)
+	require.NoError(t, err)
+	require.Equal(t, 1/3600.0, g.CellSize)
+	require.Equal(t, 37, g.Cols)
+	require.Equal(t, 19, g.Rows)
+	require.Equal(t, g.Rows*g.Cols, len(g.Elevations))
+	tile, err := data.loadTile(bbox.SouthWest)
+	require.NoError(t, err)
+	for _, node := range [][2]int{{0, 0}, {g.Rows - 1, g.Cols - 1}, {7, 11}} {
+		e, err := tile.GetElevation(LatLng{
+			Latitude:  g.NorthWest.Latitude - float64(node[0])*g.CellSize,
+			Longitude: g.NorthWest.Longitude + float64(node[1])*g.CellSize,
+		})
+		require.NoError(t, err)
+		require.Equal(t, int16(math.Round(e)), g.At(node[0], node[1]))
+	}
+}
+
+func TestWindow_TileEdge(t *testing.T) {
+	data, err := New(1, "testdata", -1)
+	require.NoError(t, err)
+	defer data.Destroy()
+	g, err := data.Window(BBox{
+		SouthWest: LatLng{Latitude: -45.001, Longitude: -65.001},
+		NorthEast: LatLng{Latitude: -45, Longitude: -65},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 4, g.Rows)
+	require.Equal(t, 4, g.Cols)
+	require.Equal(t, -45.0, g.NorthWest.Latitude)
+	require.NotEqual(t, Void, g.At(0, g.Cols-1))
+}
+
+func TestWindow_MissingTiles(t *testing.T) {
+	bbox, err := ParseBBox("10.5,10.5,10.51,10.505")
+	require.NoError(t, err)
+	for _, tt := range []struct {
+		name  string
+		opts  []Option
+		value int16
+		err   bool
+	}{
+		{name: "without fallback", err: true},
+		{name: "fallback", opts: []Option{WithFallbackElevation(0)}, value: 0},
+		{name: "fill", opts: []Option{WithFillValue(-5)}, value: -5},
+		{name: "fallback before fill", opts: []Option{WithFallbackElevation(0), WithFillValue(-5)}, value: 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := NewWithOptions(append(tt.opts,
+				WithTileDirectory(t.TempDir()),
+				WithExpiration(-1),
+				WithOffline(true),
+			)...)
+			require.NoError(t, err)
+			defer data.Destroy()
+			g, err := data.Window(bbox)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, 1/1200.0, g.CellSize)
+			require.Equal(t, 13, g.Cols)
+			require.Equal(t, 7, g.Rows)
+			require.Equal(t, len(g.Elevations), len(g.Filled))
+			for i := range g.Elevations {
+				require.Equal(t, tt.value, g.Elevations[i])
+				require.True(t, g.Filled[i])
+			}
+		})
+	}
+}
+
+func TestParseBBox(t *testing.T) {
+	bbox, err := ParseBBox("-66,-46,-65,-45")
+	require.NoError(t, err)
+	require.Equal(t, []LatLng{{Latitude: -46, Longitude: -66}}, bbox.tiles())
+	_, err = ParseBBox("-65,-46,-66,-45")
+	require.Error(t, err)
+	_, err = ParseBBox("-65,-46,-66")
+	require.Error(t, err)
+}
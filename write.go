@@ -0,0 +1,70 @@
+package srtm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// WriteHGT writes grid of elevations of tile with size (1201 for 3 arcseconds or 3601
+// for 1 arcsecond) in big-endian hgt format. Grid contains rows from north to south,
+// each row from west to east (as elevations returned by ReadFile)
+func WriteHGT(w io.Writer, grid []int16, size int) error {
+	if _, err := tileSize(int64(size) * int64(size) * 2); err != nil {
+		return fmt.Errorf("hgt size %d is not supported (only 1201 and 3601 supported)", size)
+	}
+	if len(grid) != size*size {
+		return fmt.Errorf("grid has %d elevations instead of %d", len(grid), size*size)
+	}
+	buf := bufio.NewWriter(w)
+	if err := binary.Write(buf, binary.BigEndian, grid); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+// WriteFile writes grid of elevations (see WriteHGT) of tile with south-west corner sw
+// into path and returns path of written file. If path is a directory, file is named by
+// key of tile (N45E006.hgt). Otherwise name of file must be a key of tile with extension
+// of format: .hgt, .hgt.gz, .hgt.zst (compressed by gzip or zstd) or .hgt.blk.
+// Size of tile is derived from size of grid. File is replaced atomically
+func WriteFile(path string, sw LatLng, grid []int16) (string, error) {
+	key := tileKey(sw)
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, key+".hgt")
+	}
+	name := filepath.Base(path)
+	format := tileFormat(name)
+	if !IsHGT(name) || name != key+"."+string(format) {
+		return "", errors.Wrapf(ErrInvalidHGTFileName, "file name '%s' of tile %s", name, key)
+	}
+	size, err := tileSize(int64(len(grid)) * 2)
+	if err != nil {
+		return "", err
+	}
+	var raw bytes.Buffer
+	raw.Grow(len(grid) * 2)
+	if err := WriteHGT(&raw, grid, size); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".write-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if err := compress(format, 0, raw.Bytes(), tmp); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := install(tmp, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
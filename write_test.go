@@ -0,0 +1,59 @@
+package srtm
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteHGT(t *testing.T) {
+	grid := make([]int16, 1201*1201)
+	grid[0], grid[1] = -1, 300
+	var buf bytes.Buffer
+	require.NoError(t, WriteHGT(&buf, grid, 1201))
+	require.Equal(t, 1201*1201*2, buf.Len())
+	require.Equal(t, []byte{0xff, 0xff, 0x01, 0x2c}, buf.Bytes()[:4])
+	require.Error(t, WriteHGT(&buf, grid, 3601))
+	require.Error(t, WriteHGT(&buf, grid[1:], 1201))
+	require.Error(t, WriteHGT(&buf, make([]int16, 100*100), 100))
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	grid := make([]int16, 3601*3601)
+	for i := range grid {
+		grid[i] = int16(i%7000 - 100)
+	}
+	grid[5] = Void
+	sw := LatLng{Latitude: -46, Longitude: -66}
+	for _, name := range []string{"", "S46W066.hgt.gz", "S46W066.hgt.zst", "S46W066.hgt.blk"} {
+		t.Run(name, func(t *testing.T) {
+			path, err := WriteFile(filepath.Join(dir, name), sw, grid)
+			require.NoError(t, err)
+			if len(name) == 0 {
+				require.Equal(t, filepath.Join(dir, "S46W066.hgt"), path)
+			}
+			s, size, elevations, err := ReadFile(path)
+			require.NoError(t, err)
+			require.Equal(t, sw, *s)
+			require.Equal(t, 3601, size)
+			require.Equal(t, grid, elevations)
+		})
+	}
+	for _, name := range []string{"N46W066.hgt", "S46W066.tif", "S46W066.hgt.bz2"} {
+		_, err := WriteFile(filepath.Join(dir, name), sw, grid)
+		require.ErrorIs(t, err, ErrInvalidHGTFileName)
+	}
+	_, err := WriteFile(dir, sw, grid[1:])
+	require.Error(t, err)
+}
+
+func TestWriteFile_Key(t *testing.T) {
+	dir := t.TempDir()
+	grid := make([]int16, 1201*1201)
+	path, err := WriteFile(dir, LatLng{Latitude: 45.5, Longitude: 6.5}, grid)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "N45E006.hgt"), path)
+}
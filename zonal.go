@@ -0,0 +1,191 @@
+package srtm
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+// HistogramBins is a number of bins in histogram of zonal statistics
+const HistogramBins = 10
+
+// HistogramBin is a count of elevations in range [From, To)
+// (the last bin of histogram includes To)
+type HistogramBin struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Count int     `json:"count"`
+}
+
+// ZonalStats contains statistics of elevations of DEM cells inside polygon
+type ZonalStats struct {
+	// Cells is a number of DEM cells inside polygon including voids
+	Cells int `json:"cells"`
+	// Voids is a number of DEM cells without elevation data (including cells
+	// of missing tiles with fallback elevation or fill value)
+	Voids int `json:"voids"`
+	// VoidPercentage is a percentage of voids in Cells
+	VoidPercentage float64        `json:"voidPercentage"`
+	Min            float64        `json:"min"`
+	Max            float64        `json:"max"`
+	Mean           float64        `json:"mean"`
+	Median         float64        `json:"median"`
+	StdDev         float64        `json:"stdDev"`
+	Histogram      []HistogramBin `json:"histogram"`
+}
+
+// ZonalStats rasterises Polygon or MultiPolygon over DEM cells and returns
+// statistics of elevations inside it. Holes of polygons are excluded
+func (d *SRTM) ZonalStats(polygon *geojson.Geometry) (*ZonalStats, error) {
+	polygons, err := zonalPolygons(polygon)
+	if err != nil {
+		return nil, err
+	}
+	bbox, err := ZonalBBox(polygon)
+	if err != nil {
+		return nil, err
+	}
+	g, err := d.Window(bbox)
+	if err != nil {
+		return nil, err
+	}
+	inside := make([]bool, len(g.Elevations))
+	for _, p := range polygons {
+		rasterise(g, p, inside)
+	}
+	values := make([]float64, 0)
+	stats := &ZonalStats{}
+	for i, in := range inside {
+		if !in {
+			continue
+		}
+		stats.Cells++
+		if g.Elevations[i] == Void || (g.Filled != nil && g.Filled[i]) {
+			stats.Voids++
+			continue
+		}
+		values = append(values, float64(g.Elevations[i]))
+	}
+	if stats.Cells == 0 {
+		return nil, fmt.Errorf("%s does not contain DEM cells", polygon.Type)
+	}
+	stats.VoidPercentage = float64(stats.Voids) * 100 / float64(stats.Cells)
+	if len(values) == 0 {
+		return stats, nil
+	}
+	sort.Float64s(values)
+	stats.Min = values[0]
+	stats.Max = values[len(values)-1]
+	if len(values)%2 == 1 {
+		stats.Median = values[len(values)/2]
+	} else {
+		stats.Median = (values[len(values)/2-1] + values[len(values)/2]) / 2
+	}
+	sum := 0.
+	for _, v := range values {
+		sum += v
+	}
+	stats.Mean = sum / float64(len(values))
+	variance := 0.
+	for _, v := range values {
+		variance += (v - stats.Mean) * (v - stats.Mean)
+	}
+	stats.StdDev = math.Sqrt(variance / float64(len(values)))
+	stats.Histogram = make([]HistogramBin, HistogramBins)
+	width := (stats.Max - stats.Min) / HistogramBins
+	for i := range stats.Histogram {
+		stats.Histogram[i].From = stats.Min + float64(i)*width
+		stats.Histogram[i].To = stats.Min + float64(i+1)*width
+	}
+	stats.Histogram[HistogramBins-1].To = stats.Max
+	for _, v := range values {
+		i := HistogramBins - 1
+		if width > 0 {
+			i = int((v - stats.Min) / width)
+		}
+		if i >= HistogramBins {
+			i = HistogramBins - 1
+		}
+		stats.Histogram[i].Count++
+	}
+	return stats, nil
+}
+
+// ZonalBBox returns bbox of Polygon or MultiPolygon of ZonalStats, for example
+// for check of area before ZonalStats
+func ZonalBBox(polygon *geojson.Geometry) (BBox, error) {
+	polygons, err := zonalPolygons(polygon)
+	if err != nil {
+		return BBox{}, err
+	}
+	bbox, ok := polygonsBBox(polygons)
+	if !ok {
+		return BBox{}, fmt.Errorf("%s has no coordinates", polygon.Type)
+	}
+	return bbox, nil
+}
+
+// zonalPolygons returns polygons of Polygon or MultiPolygon
+func zonalPolygons(polygon *geojson.Geometry) ([][][][]float64, error) {
+	switch polygon.Type {
+	case geojson.GeometryPolygon:
+		return [][][][]float64{polygon.Polygon}, nil
+	case geojson.GeometryMultiPolygon:
+		return polygon.MultiPolygon, nil
+	default:
+		return nil, fmt.Errorf("zonal statistics supports only Polygon and MultiPolygon geometries (got %s)", polygon.Type)
+	}
+}
+
+func polygonsBBox(polygons [][][][]float64) (bbox BBox, ok bool) {
+	bbox = BBox{
+		SouthWest: LatLng{Latitude: math.Inf(1), Longitude: math.Inf(1)},
+		NorthEast: LatLng{Latitude: math.Inf(-1), Longitude: math.Inf(-1)},
+	}
+	for _, polygon := range polygons {
+		for _, ring := range polygon {
+			for _, p := range ring {
+				bbox.Extend(p)
+			}
+		}
+	}
+	return bbox, !math.IsInf(bbox.SouthWest.Latitude, 1)
+}
+
+// rasterise marks grid nodes inside polygon (even-odd rule over all rings,
+// so holes are excluded) with scanline algorithm
+func rasterise(g *Grid, polygon [][][]float64, inside []bool) {
+	xs := make([]float64, 0)
+	for row := 0; row < g.Rows; row++ {
+		y := g.NorthWest.Latitude - float64(row)*g.CellSize
+		xs = xs[:0]
+		for _, ring := range polygon {
+			for i := range ring {
+				p1, p2 := ring[i], ring[(i+1)%len(ring)]
+				if len(p1) < 2 || len(p2) < 2 {
+					continue
+				}
+				if (p1[1] <= y) == (p2[1] <= y) {
+					continue
+				}
+				xs = append(xs, p1[0]+(y-p1[1])*(p2[0]-p1[0])/(p2[1]-p1[1]))
+			}
+		}
+		sort.Float64s(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			from := int(math.Ceil((xs[i] - g.NorthWest.Longitude) / g.CellSize))
+			to := int(math.Floor((xs[i+1] - g.NorthWest.Longitude) / g.CellSize))
+			if from < 0 {
+				from = 0
+			}
+			if to >= g.Cols {
+				to = g.Cols - 1
+			}
+			for col := from; col <= to; col++ {
+				inside[row*g.Cols+col] = true
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package srtm
+
+import (
+	"testing"
+
+	geojson "github.com/paulmach/go.geojson"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZonalStats(t *testing.T) {
+	data, err := New(1, "testdata", -1)
+	require.NoError(t, err)
+	defer data.Destroy()
+	// corners of squares are placed between DEM nodes
+	h := 0.5 / 3600
+	square := [][]float64{{-65.51 - h, -45.51 - h}, {-65.49 + h, -45.51 - h}, {-65.49 + h, -45.49 + h}, {-65.51 - h, -45.49 + h}, {-65.51 - h, -45.51 - h}}
+	stats, err := data.ZonalStats(geojson.NewPolygonGeometry([][][]float64{square}))
+	require.NoError(t, err)
+	// 0.02 degree side contains 72 cells of 1 arcsecond tile (+1 node)
+	require.Equal(t, 73*73, stats.Cells)
+	require.Equal(t, 0, stats.Voids)
+	require.True(t, stats.Min <= stats.Median && stats.Median <= stats.Max)
+	require.True(t, stats.Min <= stats.Mean && stats.Mean <= stats.Max)
+	require.Equal(t, HistogramBins, len(stats.Histogram))
+	total := 0
+	for _, bin := range stats.Histogram {
+		total += bin.Count
+	}
+	require.Equal(t, stats.Cells, total)
+	hole := [][]float64{{-65.505 - h, -45.505 - h}, {-65.495 + h, -45.505 - h}, {-65.495 + h, -45.495 + h}, {-65.505 - h, -45.495 + h}, {-65.505 - h, -45.505 - h}}
+	holed, err := data.ZonalStats(geojson.NewPolygonGeometry([][][]float64{square, hole}))
+	require.NoError(t, err)
+	require.Equal(t, 73*73-37*37, holed.Cells)
+	multi, err := data.ZonalStats(geojson.NewMultiPolygonGeometry([][][]float64{square, hole}, [][][]float64{hole}))
+	require.NoError(t, err)
+	require.Equal(t, stats.Cells, multi.Cells)
+}
+
+func TestZonalStats_MissingTile(t *testing.T) {
+	data, err := NewWithOptions(
+		WithTileDirectory("testdata"),
+		WithExpiration(-1),
+		WithOffline(true),
+		WithFallbackElevation(0),
+	)
+	require.NoError(t, err)
+	defer data.Destroy()
+	// square crosses east edge of tile S46W066, tile S46W065 is missing
+	h := 0.5 / 3600
+	square := [][]float64{{-65.01 - h, -45.51 - h}, {-64.99 + h, -45.51 - h}, {-64.99 + h, -45.49 + h}, {-65.01 - h, -45.49 + h}, {-65.01 - h, -45.51 - h}}
+	stats, err := data.ZonalStats(geojson.NewPolygonGeometry([][][]float64{square}))
+	require.NoError(t, err)
+	require.Equal(t, 73*73, stats.Cells)
+	// nodes of the tile edge belong to missing tile
+	require.Equal(t, 73*37, stats.Voids)
+	// square inside of missing tile
+	square = [][]float64{{-64.51 - h, -45.51 - h}, {-64.49 + h, -45.51 - h}, {-64.49 + h, -45.49 + h}, {-64.51 - h, -45.49 + h}, {-64.51 - h, -45.51 - h}}
+	stats, err = data.ZonalStats(geojson.NewPolygonGeometry([][][]float64{square}))
+	require.NoError(t, err)
+	require.Equal(t, stats.Cells, stats.Voids)
+	require.Equal(t, 100.0, stats.VoidPercentage)
+}
+
+func TestZonalStats_NotPolygon(t *testing.T) {
+	data, err := New(1, "testdata", -1)
+	require.NoError(t, err)
+	defer data.Destroy()
+	_, err = data.ZonalStats(geojson.NewPointGeometry([]float64{-65.5, -45.5}))
+	require.Error(t, err)
+}
+
+func TestZonalBBox(t *testing.T) {
+	square := [][]float64{{1, 2}, {3, 2}, {3, 5}, {1, 5}, {1, 2}}
+	bbox, err := ZonalBBox(geojson.NewMultiPolygonGeometry([][][]float64{square}, [][][]float64{{{-1, 0}, {0, 0}, {0, 1}, {-1, 0}}}))
+	require.NoError(t, err)
+	require.Equal(t, BBox{SouthWest: LatLng{Latitude: 0, Longitude: -1}, NorthEast: LatLng{Latitude: 5, Longitude: 3}}, bbox)
+	_, err = ZonalBBox(geojson.NewPolygonGeometry(nil))
+	require.Error(t, err)
+	_, err = ZonalBBox(geojson.NewPointGeometry([]float64{1, 2}))
+	require.Error(t, err)
+}